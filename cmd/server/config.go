@@ -2,9 +2,13 @@ package main
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/andyleap/passkey/internal/models"
+	"github.com/andyleap/passkey/internal/oauth"
 	"github.com/jessevdk/go-flags"
 	"gopkg.in/yaml.v3"
 )
@@ -17,9 +21,14 @@ type Config struct {
 	RPOrigins     []string `long:"rp-origin" env:"RP_ORIGIN" env-delim:"," default:"http://localhost:8443" description:"Relying party origins"`
 	IndexRedirect string   `long:"index-redirect" env:"INDEX_REDIRECT" description:"URL to redirect index page to (leave empty for landing page)"`
 
+	// TrustedProxies are the reverse proxies whose X-Forwarded-For header is
+	// used for the client address
+	TrustedProxies []string `long:"trusted-proxy" env:"TRUSTED_PROXIES" env-delim:"," description:"Addresses or CIDR ranges of reverse proxies trusted to set X-Forwarded-For"`
+
 	// Storage config
 	StorageMode string `long:"storage-mode" env:"STORAGE_MODE" default:"filesystem" choice:"filesystem" choice:"s3" description:"User storage backend"`
 	SessionMode string `long:"session-mode" env:"SESSION_MODE" default:"memory" choice:"memory" choice:"redis" description:"Session storage backend"`
+	ClientMode  string `long:"client-mode" env:"CLIENT_MODE" default:"storage" choice:"storage" choice:"memory" description:"Storage for OAuth clients registered at runtime: the user storage backend or memory"`
 
 	// Filesystem storage
 	DataPath string `long:"data-path" env:"DATA_PATH" default:"./data" description:"Filesystem storage directory"`
@@ -41,7 +50,28 @@ type Config struct {
 	} `group:"Redis Options"`
 
 	// OAuth config
-	OAuthClientsFile string `long:"oauth-clients-file" env:"OAUTH_CLIENTS_FILE" description:"Path to OAuth clients YAML configuration file"`
+	OAuthClientsFile string `long:"oauth-clients-file" env:"OAUTH_CLIENTS_FILE" description:"Path to OAuth clients YAML configuration file (reloaded on change or SIGHUP)"`
+	PKCEDisablePlain bool   `long:"pkce-disable-plain" env:"PKCE_DISABLE_PLAIN" description:"Reject the PKCE plain code_challenge_method (S256 only)"`
+
+	// OAuthClientsPoll is how often the clients file is checked for changes
+	OAuthClientsPoll time.Duration `long:"oauth-clients-poll" env:"OAUTH_CLIENTS_POLL" default:"10s" description:"How often to check the OAuth clients file for changes (0 to only reload on SIGHUP)"`
+
+	// ClientRegistrationToken is the initial access token for /oauth/register
+	ClientRegistrationToken string `long:"client-registration-token" env:"CLIENT_REGISTRATION_TOKEN" description:"Initial access token required to register OAuth clients at /oauth/register (registration is disabled if empty)"`
+
+	// Token lifetimes
+	AccessTokenLifetime  time.Duration `long:"access-token-lifetime" env:"ACCESS_TOKEN_LIFETIME" default:"1h" description:"Lifetime of issued access tokens"`
+	RefreshTokenLifetime time.Duration `long:"refresh-token-lifetime" env:"REFRESH_TOKEN_LIFETIME" default:"720h" description:"Lifetime of issued refresh tokens (each use issues a new one)"`
+
+	// OpenID Connect config
+	Issuer         string `long:"issuer" env:"OIDC_ISSUER" description:"OpenID Connect issuer URL (defaults to the first RP origin)"`
+	SigningAlg     string `long:"signing-alg" env:"OIDC_SIGNING_ALG" default:"RS256" choice:"RS256" choice:"ES256" choice:"EdDSA" description:"ID token signing algorithm"`
+	SigningKeyFile string `long:"signing-key-file" env:"OIDC_SIGNING_KEY_FILE" description:"PEM private key for ID tokens (generated and kept in user storage if empty)"`
+
+	// Signing key rotation (not used with a key file)
+	SigningKeyRotation  time.Duration `long:"signing-key-rotation" env:"OIDC_SIGNING_KEY_ROTATION" default:"2160h" description:"How often to rotate the signing key (0 disables automatic rotation)"`
+	SigningKeyRetention time.Duration `long:"signing-key-retention" env:"OIDC_SIGNING_KEY_RETENTION" default:"24h" description:"How long retired keys stay in the JWKS (must exceed the longest token lifetime)"`
+	RotateSigningKey    bool          `long:"rotate-signing-key" description:"Rotate the signing key in storage and exit"`
 }
 
 // LoadConfig parses configuration from environment variables and command line flags
@@ -58,6 +88,12 @@ func LoadConfig() (*Config, error) {
 		return nil, fmt.Errorf("failed to parse config: %w", err)
 	}
 
+	// Default the issuer to the service's own origin
+	if config.Issuer == "" && len(config.RPOrigins) > 0 {
+		config.Issuer = config.RPOrigins[0]
+	}
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+
 	// Load OAuth clients if configured
 	if err := config.loadOAuthClients(); err != nil {
 		return nil, fmt.Errorf("failed to load OAuth clients: %w", err)
@@ -82,29 +118,149 @@ func (c *Config) loadOAuthClients() error {
 		return nil
 	}
 
-	data, err := os.ReadFile(c.OAuthClientsFile)
+	clients, err := readOAuthClientsFile(c.OAuthClientsFile)
+	if err != nil {
+		return err
+	}
+
+	LoadedOAuthClients = clients
+	return nil
+}
+
+// readOAuthClientsFile parses and validates an OAuth clients file
+func readOAuthClientsFile(path string) (map[string]*models.Client, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return fmt.Errorf("failed to read OAuth clients file %s: %w", c.OAuthClientsFile, err)
+		return nil, fmt.Errorf("failed to read OAuth clients file %s: %w", path, err)
 	}
 
 	var config OAuthClientsConfig
 	if err := yaml.Unmarshal(data, &config); err != nil {
-		return fmt.Errorf("failed to parse YAML OAuth clients file: %w", err)
+		return nil, fmt.Errorf("failed to parse YAML OAuth clients file: %w", err)
 	}
 
 	// Convert to map for easy lookup and validate
-	LoadedOAuthClients = make(map[string]*models.Client)
+	clients := make(map[string]*models.Client)
 	for _, client := range config.Clients {
 		if client.ID == "" {
-			return fmt.Errorf("OAuth client missing required 'id' field")
+			return nil, fmt.Errorf("OAuth client missing required 'id' field")
+		}
+		if _, exists := clients[client.ID]; exists {
+			return nil, fmt.Errorf("OAuth client '%s' is defined more than once", client.ID)
 		}
 		if client.Name == "" {
 			client.Name = client.ID // Default name to ID
 		}
-		if len(client.RedirectURIs) == 0 {
-			return fmt.Errorf("OAuth client '%s' missing required 'redirect_uris' field", client.ID)
+		if err := validateClientAuth(client); err != nil {
+			return nil, fmt.Errorf("OAuth client '%s': %w", client.ID, err)
+		}
+		// Confidential clients may only use client_credentials, which has no redirect
+		if len(client.RedirectURIs) == 0 && !client.IsConfidential() {
+			return nil, fmt.Errorf("OAuth client '%s' missing required 'redirect_uris' field", client.ID)
+		}
+		for _, redirectURI := range client.RedirectURIs {
+			if err := oauth.ValidateRedirectURI(client, redirectURI); err != nil {
+				return nil, fmt.Errorf("OAuth client '%s': invalid redirect_uri '%s': %w", client.ID, redirectURI, err)
+			}
+			if client.NativeApp && oauth.IsLocalhostRedirectURI(redirectURI) {
+				// Only loopback IP addresses match any port
+				slog.Warn("Native app redirect URI uses localhost; register http://127.0.0.1 instead to allow any port",
+					"client_id", client.ID, "redirect_uri", redirectURI)
+			}
+		}
+		for _, redirectURI := range client.PostLogoutRedirectURIs {
+			if err := oauth.ValidateRedirectURI(client, redirectURI); err != nil {
+				return nil, fmt.Errorf("OAuth client '%s': invalid post_logout_redirect_uri '%s': %w", client.ID, redirectURI, err)
+			}
+		}
+		if client.BackchannelLogoutURI != "" {
+			if err := oauth.ValidateBackchannelLogoutURI(client.BackchannelLogoutURI); err != nil {
+				return nil, fmt.Errorf("OAuth client '%s': invalid backchannel_logout_uri: %w", client.ID, err)
+			}
+		}
+		switch client.AccessTokenFormat {
+		case "":
+			client.AccessTokenFormat = models.AccessTokenFormatOpaque
+		case models.AccessTokenFormatOpaque, models.AccessTokenFormatJWT:
+		default:
+			return nil, fmt.Errorf("OAuth client '%s': unsupported access_token_format '%s'", client.ID, client.AccessTokenFormat)
+		}
+		switch client.ResponseMode {
+		case "":
+			client.ResponseMode = models.ResponseModeQuery
+		case models.ResponseModeQuery, models.ResponseModeFragment, models.ResponseModeFormPost:
+		default:
+			return nil, fmt.Errorf("OAuth client '%s': unsupported response_mode '%s'", client.ID, client.ResponseMode)
+		}
+		clients[client.ID] = client
+	}
+
+	return clients, nil
+}
+
+// validateClientAuth checks the client's token endpoint authentication settings
+func validateClientAuth(client *models.Client) error {
+	if client.TokenEndpointAuthMethod == "" {
+		// Clients with a secret default to HTTP Basic, otherwise they're public
+		client.TokenEndpointAuthMethod = models.AuthMethodNone
+		if len(client.ClientSecretHashes) > 0 {
+			client.TokenEndpointAuthMethod = models.AuthMethodClientSecretBasic
+		}
+	}
+
+	if client.TokenEndpointAuthMethod == models.AuthMethodPrivateKeyJWT {
+		return validateClientKeys(client)
+	}
+	if client.JWKS != "" || client.JWKSURI != "" {
+		return fmt.Errorf("'jwks' and 'jwks_uri' are only used with token_endpoint_auth_method 'private_key_jwt'")
+	}
+
+	switch client.TokenEndpointAuthMethod {
+	case models.AuthMethodNone:
+		if len(client.ClientSecretHashes) > 0 {
+			return fmt.Errorf("'client_secret_hashes' not allowed with token_endpoint_auth_method 'none'")
+		}
+		return nil
+	case models.AuthMethodClientSecretBasic, models.AuthMethodClientSecretPost:
+	default:
+		return fmt.Errorf("unsupported token_endpoint_auth_method '%s'", client.TokenEndpointAuthMethod)
+	}
+
+	if len(client.ClientSecretHashes) == 0 {
+		return fmt.Errorf("confidential client missing required 'client_secret_hashes' field")
+	}
+	if len(client.ClientSecretHashes) > 2 {
+		return fmt.Errorf("at most two active client secrets are allowed")
+	}
+	for i, hash := range client.ClientSecretHashes {
+		if err := oauth.ValidateClientSecretHash(hash); err != nil {
+			return fmt.Errorf("invalid client secret hash %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// validateClientKeys checks the keys a private_key_jwt client signs its
+// client assertions with
+func validateClientKeys(client *models.Client) error {
+	if len(client.ClientSecretHashes) > 0 {
+		return fmt.Errorf("'client_secret_hashes' not allowed with token_endpoint_auth_method 'private_key_jwt'")
+	}
+
+	switch {
+	case client.JWKS != "" && client.JWKSURI != "":
+		return fmt.Errorf("set only one of 'jwks' and 'jwks_uri'")
+	case client.JWKS != "":
+		if err := oauth.ValidateClientJWKS(client.JWKS); err != nil {
+			return fmt.Errorf("invalid jwks: %w", err)
+		}
+	case client.JWKSURI != "":
+		if err := oauth.ValidateJWKSURI(client.JWKSURI); err != nil {
+			return fmt.Errorf("invalid jwks_uri: %w", err)
 		}
-		LoadedOAuthClients[client.ID] = client
+	default:
+		return fmt.Errorf("private_key_jwt client missing required 'jwks' or 'jwks_uri' field")
 	}
 
 	return nil
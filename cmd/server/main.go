@@ -10,6 +10,7 @@ import (
 
 	"github.com/andyleap/passkey/internal/api"
 	"github.com/andyleap/passkey/internal/auth"
+	"github.com/andyleap/passkey/internal/keys"
 	"github.com/andyleap/passkey/internal/oauth"
 	"github.com/andyleap/passkey/internal/storage"
 	"github.com/andyleap/passkey/internal/ui"
@@ -43,6 +44,9 @@ func main() {
 
 	// Setup user storage
 	var userStorage storage.UserStorage
+	var keyStorage storage.KeyStorage
+	var consentStorage storage.ConsentStorage
+	var clientStorage storage.ClientStorage
 	switch cfg.StorageMode {
 	case "s3":
 		s3Storage, err := storage.NewS3Storage(cfg.S3.Endpoint, cfg.S3.AccessKey, cfg.S3.SecretKey, cfg.S3.Bucket, cfg.S3.UseSSL)
@@ -51,6 +55,9 @@ func main() {
 			os.Exit(1)
 		}
 		userStorage = s3Storage
+		keyStorage = s3Storage
+		consentStorage = s3Storage
+		clientStorage = s3Storage
 		slog.Info("Using S3 storage", "endpoint", cfg.S3.Endpoint, "bucket", cfg.S3.Bucket)
 	case "filesystem":
 		fsStorage, err := storage.NewFilesystemStorage(cfg.DataPath)
@@ -59,12 +66,50 @@ func main() {
 			os.Exit(1)
 		}
 		userStorage = fsStorage
+		keyStorage = fsStorage
+		consentStorage = fsStorage
+		clientStorage = fsStorage
 		slog.Info("Using filesystem storage", "path", cfg.DataPath)
 	default:
 		slog.Error("Invalid STORAGE_MODE", "mode", cfg.StorageMode, "valid_modes", []string{"s3", "filesystem"})
 		os.Exit(1)
 	}
 
+	// Setup OAuth client registry; clients from the clients file are layered
+	// on top and can't be changed at runtime
+	switch cfg.ClientMode {
+	case "memory":
+		clientStorage = storage.NewMemoryClientStorage()
+		slog.Warn("Using in-memory client registry (registered clients are not persistent)")
+	case "storage":
+		slog.Info("Using user storage for registered clients", "mode", cfg.StorageMode)
+	}
+	clientRegistry := storage.NewConfigClientStorage(LoadedOAuthClients, clientStorage)
+	watchOAuthClients(cfg.OAuthClientsFile, cfg.OAuthClientsPoll, clientRegistry, LoadedOAuthClients)
+
+	// Setup ID token signing keys
+	var keyManager *keys.Manager
+	if cfg.SigningKeyFile != "" {
+		keyManager, err = keys.NewStaticManager(cfg.SigningAlg, cfg.SigningKeyFile)
+	} else {
+		keyManager, err = keys.NewManager(context.Background(), keyStorage, cfg.SigningAlg, cfg.SigningKeyRotation, cfg.SigningKeyRetention)
+	}
+	if err != nil {
+		slog.Error("Failed to load signing keys", "error", err)
+		os.Exit(1)
+	}
+
+	if cfg.RotateSigningKey {
+		if err := keyManager.Rotate(context.Background()); err != nil {
+			slog.Error("Failed to rotate signing key", "error", err)
+			os.Exit(1)
+		}
+		slog.Info("Rotated signing key; running servers pick it up within a minute")
+		return
+	}
+
+	go keyManager.Start(context.Background())
+
 	// Setup session storage
 	var sessionStorage storage.SessionStorage
 	switch cfg.SessionMode {
@@ -93,25 +138,58 @@ func main() {
 	}
 
 	// Setup services
-	webauthnService := auth.NewWebAuthnService(webAuthn, userStorage, sessionStorage)
-	oauthService := oauth.NewOAuthService(sessionStorage, LoadedOAuthClients)
-	apiServer := api.NewServer(webauthnService, sessionStorage)
+	oauthService := oauth.NewOAuthService(sessionStorage, userStorage, consentStorage, clientRegistry, keyManager, oauth.Options{
+		Issuer:               cfg.Issuer,
+		AllowPlainPKCE:       !cfg.PKCEDisablePlain,
+		AccessTokenLifetime:  cfg.AccessTokenLifetime,
+		RefreshTokenLifetime: cfg.RefreshTokenLifetime,
+		RegistrationToken:    cfg.ClientRegistrationToken,
+	})
+	go oauthService.StartBackchannelLogout(context.Background())
+	webauthnService := auth.NewWebAuthnService(webAuthn, userStorage, sessionStorage, oauthService)
+	apiServer := api.NewServer(webauthnService, sessionStorage, oauthService)
 
 	// Setup OAuth handlers
-	oauthUIHandlers, err := ui.NewOAuthUIHandlers(oauthService)
+	trustedProxies, err := ui.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		slog.Error("Invalid TRUSTED_PROXIES", "error", err)
+		os.Exit(1)
+	}
+	oauthUIHandlers, err := ui.NewOAuthUIHandlers(oauthService, sessionStorage, trustedProxies)
 	if err != nil {
 		slog.Error("Failed to create OAuth UI handlers", "error", err)
 		os.Exit(1)
 	}
-	oauthAPIHandlers := api.NewOAuthAPIHandlers(oauthService)
+	oauthAPIHandlers := api.NewOAuthAPIHandlers(oauthService, sessionStorage, userStorage)
 
 	// Setup routes
 	mux := http.NewServeMux()
 
 	// OAuth routes (main flow)
 	mux.HandleFunc("GET /authorize", oauthUIHandlers.AuthorizeHandler)
-	mux.HandleFunc("POST /oauth/complete", oauthAPIHandlers.CompleteHandler)
+	mux.HandleFunc("GET /oauth/consent", oauthUIHandlers.ConsentHandler)
+	mux.HandleFunc("POST /oauth/consent", oauthUIHandlers.ConsentDecisionHandler)
+	mux.HandleFunc("GET /device", oauthUIHandlers.DeviceHandler)
+	mux.HandleFunc("POST /device", oauthUIHandlers.DeviceDecisionHandler)
+	mux.HandleFunc("GET /oauth/logout", oauthUIHandlers.EndSessionHandler)
+	mux.HandleFunc("POST /oauth/logout", oauthUIHandlers.EndSessionHandler)
+	mux.HandleFunc("POST /oauth/logout/confirm", oauthUIHandlers.EndSessionConfirmHandler)
 	mux.HandleFunc("POST /oauth/token", oauthAPIHandlers.TokenHandler)
+	mux.HandleFunc("POST /oauth/device_authorization", oauthAPIHandlers.DeviceAuthorizationHandler)
+	mux.HandleFunc("POST /oauth/par", oauthAPIHandlers.PushedAuthorizationRequestHandler)
+	mux.HandleFunc("POST /oauth/introspect", oauthAPIHandlers.IntrospectHandler)
+	mux.HandleFunc("POST /oauth/revoke", oauthAPIHandlers.RevokeHandler)
+	mux.HandleFunc("POST /oauth/backchannel_logout/attempts", oauthAPIHandlers.BackchannelLogoutAttemptsHandler)
+	mux.HandleFunc("POST /oauth/register", oauthAPIHandlers.RegisterClientHandler)
+	mux.HandleFunc("GET /oauth/register/{clientId}", oauthAPIHandlers.ClientConfigurationHandler)
+	mux.HandleFunc("PUT /oauth/register/{clientId}", oauthAPIHandlers.UpdateClientConfigurationHandler)
+	mux.HandleFunc("DELETE /oauth/register/{clientId}", oauthAPIHandlers.DeleteClientConfigurationHandler)
+	mux.HandleFunc("GET /oauth/userinfo", oauthAPIHandlers.UserInfoHandler)
+	mux.HandleFunc("POST /oauth/userinfo", oauthAPIHandlers.UserInfoHandler)
+
+	// OpenID Connect discovery
+	mux.HandleFunc("GET /.well-known/openid-configuration", oauthAPIHandlers.DiscoveryHandler)
+	mux.HandleFunc("GET /.well-known/jwks.json", oauthAPIHandlers.JWKSHandler)
 
 	// OAuth static assets (embedded) - simplified wildcard handler
 	mux.HandleFunc("GET /oauth/{filename}", oauthUIHandlers.AssetsHandler)
@@ -130,6 +208,8 @@ func main() {
 	mux.HandleFunc("GET /api/v1/user/sessions", apiServer.UserSessionsHandler)
 	mux.HandleFunc("DELETE /api/v1/user/credentials/{credentialId}", apiServer.DeleteCredentialHandler)
 	mux.HandleFunc("DELETE /api/v1/user/sessions/{sessionId}", apiServer.DeleteSessionHandler)
+	mux.HandleFunc("GET /api/v1/user/grants", oauthAPIHandlers.UserGrantsHandler)
+	mux.HandleFunc("DELETE /api/v1/user/grants/{clientId}", oauthAPIHandlers.DeleteGrantHandler)
 
 	// Index page (landing or redirect)
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -156,6 +236,16 @@ func main() {
 	fmt.Println("OAuth endpoints:")
 	fmt.Println("  GET  /authorize              - OAuth authorization (redirect apps here)")
 	fmt.Println("  POST /oauth/token            - Token exchange")
+	fmt.Println("  POST /oauth/introspect       - Token introspection")
+	fmt.Println("  POST /oauth/revoke           - Token revocation")
+	fmt.Println("  POST /oauth/device_authorization - Device authorization (RFC 8628)")
+	fmt.Println("  POST /oauth/par              - Pushed authorization requests (RFC 9126)")
+	fmt.Println("  POST /oauth/register         - Dynamic client registration (RFC 7591)")
+	fmt.Println("  GET  /device                 - Device user code entry")
+	fmt.Println("  GET  /oauth/logout           - OpenID Connect RP-initiated logout")
+	fmt.Println("  GET  /oauth/userinfo         - OpenID Connect user info")
+	fmt.Println("  GET  /.well-known/openid-configuration - OpenID Connect discovery")
+	fmt.Println("  GET  /.well-known/jwks.json  - ID token signing keys")
 	fmt.Println("API endpoints:")
 	fmt.Println("  POST /api/v1/register/begin  - WebAuthn registration")
 	fmt.Println("  POST /api/v1/register/finish")
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/andyleap/passkey/internal/models"
+	"github.com/andyleap/passkey/internal/storage"
+)
+
+// clientsWatcher reloads the OAuth clients file into the client registry when
+// the file changes or the process receives SIGHUP
+type clientsWatcher struct {
+	path     string
+	registry *storage.ConfigClientStorage
+	// clients is the set most recently loaded, to diff reloads against
+	clients map[string]*models.Client
+	modTime time.Time
+	size    int64
+}
+
+// watchOAuthClients starts reloading the clients file in the background. The
+// file is checked for changes every poll interval, or only on SIGHUP if poll
+// is zero.
+func watchOAuthClients(path string, poll time.Duration, registry *storage.ConfigClientStorage, clients map[string]*models.Client) {
+	watcher := &clientsWatcher{
+		path:     path,
+		registry: registry,
+		clients:  clients,
+	}
+	if path != "" {
+		watcher.modTime, watcher.size, _ = fileVersion(path)
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var tick <-chan time.Time
+	if path != "" && poll > 0 {
+		tick = time.NewTicker(poll).C
+	}
+
+	go func() {
+		for {
+			select {
+			case <-hup:
+				watcher.reload("sighup")
+			case <-tick:
+				if watcher.changed() {
+					watcher.reload("file changed")
+				}
+			}
+		}
+	}()
+}
+
+// changed reports whether the file's modification time or size differs from
+// when it was last loaded
+func (w *clientsWatcher) changed() bool {
+	modTime, size, err := fileVersion(w.path)
+	if err != nil {
+		// Reported by reload once the file is back, if it ever is
+		return false
+	}
+	return !modTime.Equal(w.modTime) || size != w.size
+}
+
+// reload validates the file and swaps in its clients. An invalid file leaves
+// the current clients in place.
+func (w *clientsWatcher) reload(trigger string) {
+	if w.path == "" {
+		slog.Warn("Ignoring OAuth clients reload: no OAUTH_CLIENTS_FILE configured", "trigger", trigger)
+		return
+	}
+
+	// Record the version before reading so a write during the read is
+	// picked up by the next poll
+	modTime, size, _ := fileVersion(w.path)
+	w.modTime, w.size = modTime, size
+
+	clients, err := readOAuthClientsFile(w.path)
+	if err != nil {
+		slog.Error("Failed to reload OAuth clients, keeping the current set", "trigger", trigger, "error", err)
+		return
+	}
+
+	added, removed, changed := diffClients(w.clients, clients)
+	w.registry.SetClients(clients)
+	w.clients = clients
+
+	slog.Info("Reloaded OAuth clients", "trigger", trigger, "clients", len(clients),
+		"added", added, "removed", removed, "changed", changed)
+}
+
+// diffClients lists the IDs of clients added, removed and changed between two
+// loads of the clients file
+func diffClients(before, after map[string]*models.Client) (added, removed, changed []string) {
+	for id, client := range after {
+		previous, exists := before[id]
+		switch {
+		case !exists:
+			added = append(added, id)
+		case !reflect.DeepEqual(previous, client):
+			changed = append(changed, id)
+		}
+	}
+	for id := range before {
+		if _, exists := after[id]; !exists {
+			removed = append(removed, id)
+		}
+	}
+
+	slices.Sort(added)
+	slices.Sort(removed)
+	slices.Sort(changed)
+	return added, removed, changed
+}
+
+func fileVersion(path string) (time.Time, int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	return info.ModTime(), info.Size(), nil
+}
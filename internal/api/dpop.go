@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/andyleap/passkey/internal/oauth"
+)
+
+// dpopProof verifies the DPoP proof sent with a request (RFC 9449 section 4)
+// and returns the thumbprint of the key that signed it. The response carries
+// the nonce the client must put in its next proof.
+func dpopProof(w http.ResponseWriter, r *http.Request, oauthService *oauth.OAuthService, accessToken string) (string, error) {
+	nonce, err := oauthService.DPoPNonce(r.Context())
+	if err != nil {
+		return "", err
+	}
+	w.Header().Set("DPoP-Nonce", nonce)
+
+	proofs := r.Header.Values("DPoP")
+	if len(proofs) != 1 {
+		return "", fmt.Errorf("%w: exactly one DPoP header is required", oauth.ErrInvalidDPoPProof)
+	}
+
+	return oauthService.VerifyDPoPProof(r.Context(), r.Method, r.URL.Path, proofs[0], accessToken)
+}
+
+// accessTokenFromRequest extracts the token from an "Authorization: Bearer"
+// or "Authorization: DPoP" header, along with the scheme it was sent with
+func accessTokenFromRequest(r *http.Request) (scheme, token string) {
+	scheme, token, _ = strings.Cut(r.Header.Get("Authorization"), " ")
+	switch {
+	case strings.EqualFold(scheme, "Bearer"):
+		return "Bearer", token
+	case strings.EqualFold(scheme, oauth.DPoPTokenType):
+		return oauth.DPoPTokenType, token
+	}
+	return "", ""
+}
+
+// verifyTokenBinding checks that a token bound to a DPoP key is sent with the
+// DPoP scheme and a proof signed by that key, and that an unbound token is
+// sent as a bearer token (RFC 9449 section 7)
+func verifyTokenBinding(w http.ResponseWriter, r *http.Request, oauthService *oauth.OAuthService, scheme, token, jkt string) error {
+	if jkt == "" {
+		if scheme == oauth.DPoPTokenType {
+			return fmt.Errorf("%w: token is not bound to a DPoP key", oauth.ErrInvalidToken)
+		}
+		return nil
+	}
+
+	if scheme != oauth.DPoPTokenType {
+		return fmt.Errorf("%w: token is bound to a DPoP key", oauth.ErrInvalidToken)
+	}
+	proofJKT, err := dpopProof(w, r, oauthService, token)
+	if err != nil {
+		return err
+	}
+	if proofJKT != jkt {
+		return fmt.Errorf("%w: proof isn't signed by the key the token is bound to", oauth.ErrInvalidDPoPProof)
+	}
+
+	return nil
+}
+
+// writeResourceError answers a request whose access token or DPoP proof was
+// rejected, with a challenge for the scheme the token was sent with
+func writeResourceError(w http.ResponseWriter, scheme string, err error) {
+	switch {
+	case errors.Is(err, oauth.ErrUseDPoPNonce):
+		writeDPoPError(w, "use_dpop_nonce", "Resource server requires nonce in DPoP proof")
+	case errors.Is(err, oauth.ErrInvalidDPoPProof):
+		slog.Warn("DPoP proof rejected", "error", err)
+		writeDPoPError(w, "invalid_dpop_proof", "The DPoP proof is invalid")
+	case errors.Is(err, oauth.ErrInvalidToken) && scheme == oauth.DPoPTokenType:
+		writeDPoPError(w, "invalid_token", "The access token is invalid or expired")
+	case errors.Is(err, oauth.ErrInvalidToken):
+		writeBearerError(w, http.StatusUnauthorized, "invalid_token", "The access token is invalid or expired", "")
+	default:
+		slog.Error("Failed to validate access token", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// writeDPoPError writes a 401 response with a DPoP challenge listing the
+// accepted proof algorithms (RFC 9449 section 7.1)
+func writeDPoPError(w http.ResponseWriter, errorCode, description string) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`DPoP realm="passkey-auth", error="%s", error_description="%s", algs="%s"`,
+		errorCode, description, strings.Join(oauth.DPoPSigningAlgorithms(), " ")))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":             errorCode,
+		"error_description": description,
+	})
+}
@@ -3,24 +3,29 @@ package api
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"time"
 
 	"github.com/andyleap/passkey/internal/auth"
+	"github.com/andyleap/passkey/internal/models"
+	"github.com/andyleap/passkey/internal/oauth"
 	"github.com/andyleap/passkey/internal/storage"
 )
 
 type Server struct {
 	webauthnService *auth.WebAuthnService
 	sessionStorage  storage.SessionStorage
+	oauthService    *oauth.OAuthService
 }
 
-func NewServer(webauthnService *auth.WebAuthnService, sessionStorage storage.SessionStorage) *Server {
+func NewServer(webauthnService *auth.WebAuthnService, sessionStorage storage.SessionStorage, oauthService *oauth.OAuthService) *Server {
 	return &Server{
 		webauthnService: webauthnService,
 		sessionStorage:  sessionStorage,
+		oauthService:    oauthService,
 	}
 }
 
@@ -42,13 +47,20 @@ func (s *Server) ValidateSessionHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	response := map[string]interface{}{
 		"valid":    true,
 		"username": session.Username,
 		"userId":   session.UserID,
 		"expires":  session.ExpiresAt,
-	})
+	}
+	if session.DPoPJKT != "" {
+		// Callers should only accept the session with a DPoP proof signed by
+		// this key
+		response["dpopJkt"] = session.DPoPJKT
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
 }
 
 func (s *Server) LogoutHandler(w http.ResponseWriter, r *http.Request) {
@@ -56,17 +68,33 @@ func (s *Server) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	if sessionID == "" {
 		sessionID = r.URL.Query().Get("sessionId")
 	}
+	// The control panel signs out with its HttpOnly session cookie
+	if sessionID == "" {
+		if cookie, err := r.Cookie(auth.SessionCookieName); err == nil {
+			sessionID = cookie.Value
+			auth.ClearSessionCookie(w)
+		}
+	}
 
 	if sessionID == "" {
 		http.Error(w, "sessionId required", http.StatusBadRequest)
 		return
 	}
 
-	if err := s.sessionStorage.DeleteSession(r.Context(), sessionID); err != nil {
-		http.Error(w, "failed to delete session", http.StatusInternalServerError)
+	session, err := s.sessionStorage.GetSession(r.Context(), sessionID)
+	if err != nil {
+		http.Error(w, "failed to get session", http.StatusInternalServerError)
 		return
 	}
 
+	// Ending the session also notifies the apps the user signed in to
+	if session != nil {
+		if err := s.oauthService.EndSession(r.Context(), session); err != nil {
+			http.Error(w, "failed to delete session", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "logged_out"})
 }
@@ -76,9 +104,11 @@ func (s *Server) HealthHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "healthy"})
 }
 
-// getUserFromRequest extracts and validates user from session
-func (s *Server) getUserFromRequest(r *http.Request) (string, error) {
-	sessionID := ""
+// sessionFromRequest extracts and validates the session referenced by the
+// session cookie or Authorization header. A session bound to a DPoP key must
+// be sent with the DPoP scheme and a proof signed by that key.
+func sessionFromRequest(w http.ResponseWriter, r *http.Request, sessionStorage storage.SessionStorage, oauthService *oauth.OAuthService) (*models.Session, error) {
+	sessionID, scheme := "", ""
 
 	// Try cookie first
 	if cookie, err := r.Cookie("session_id"); err == nil {
@@ -87,24 +117,38 @@ func (s *Server) getUserFromRequest(r *http.Request) (string, error) {
 
 	// Try Authorization header
 	if sessionID == "" {
-		if auth := r.Header.Get("Authorization"); auth != "" {
-			if len(auth) > 7 && auth[:7] == "Bearer " {
-				sessionID = auth[7:]
-			}
-		}
+		scheme, sessionID = accessTokenFromRequest(r)
 	}
 
 	if sessionID == "" {
-		return "", fmt.Errorf("no session found")
+		return nil, fmt.Errorf("no session found")
 	}
 
-	session, err := s.sessionStorage.GetSession(r.Context(), sessionID)
+	session, err := sessionStorage.GetSession(r.Context(), sessionID)
 	if err != nil || session == nil {
-		return "", fmt.Errorf("invalid session")
+		return nil, fmt.Errorf("invalid session")
 	}
 
 	if session.ExpiresAt.Before(time.Now()) {
-		return "", fmt.Errorf("session expired")
+		return nil, fmt.Errorf("session expired")
+	}
+
+	if err := verifyTokenBinding(w, r, oauthService, scheme, sessionID, session.DPoPJKT); err != nil {
+		if errors.Is(err, oauth.ErrUseDPoPNonce) {
+			// The client retries with the nonce from the DPoP-Nonce header
+			w.Header().Set("WWW-Authenticate", `DPoP error="use_dpop_nonce"`)
+		}
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// getUserFromRequest extracts and validates user from session
+func (s *Server) getUserFromRequest(w http.ResponseWriter, r *http.Request) (string, error) {
+	session, err := sessionFromRequest(w, r, s.sessionStorage, s.oauthService)
+	if err != nil {
+		return "", err
 	}
 
 	return session.Username, nil
@@ -112,7 +156,7 @@ func (s *Server) getUserFromRequest(r *http.Request) (string, error) {
 
 // UserCredentialsHandler returns user's credentials
 func (s *Server) UserCredentialsHandler(w http.ResponseWriter, r *http.Request) {
-	username, err := s.getUserFromRequest(r)
+	username, err := s.getUserFromRequest(w, r)
 	if err != nil {
 		http.Error(w, "Authentication required", http.StatusUnauthorized)
 		return
@@ -144,7 +188,7 @@ func (s *Server) UserCredentialsHandler(w http.ResponseWriter, r *http.Request)
 
 // UserSessionsHandler returns user's active sessions
 func (s *Server) UserSessionsHandler(w http.ResponseWriter, r *http.Request) {
-	username, err := s.getUserFromRequest(r)
+	username, err := s.getUserFromRequest(w, r)
 	if err != nil {
 		http.Error(w, "Authentication required", http.StatusUnauthorized)
 		return
@@ -177,7 +221,7 @@ func (s *Server) UserSessionsHandler(w http.ResponseWriter, r *http.Request) {
 
 // DeleteCredentialHandler deletes a specific credential
 func (s *Server) DeleteCredentialHandler(w http.ResponseWriter, r *http.Request) {
-	username, err := s.getUserFromRequest(r)
+	username, err := s.getUserFromRequest(w, r)
 	if err != nil {
 		http.Error(w, "Authentication required", http.StatusUnauthorized)
 		return
@@ -202,7 +246,7 @@ func (s *Server) DeleteCredentialHandler(w http.ResponseWriter, r *http.Request)
 
 // DeleteSessionHandler deletes a specific session
 func (s *Server) DeleteSessionHandler(w http.ResponseWriter, r *http.Request) {
-	username, err := s.getUserFromRequest(r)
+	username, err := s.getUserFromRequest(w, r)
 	if err != nil {
 		http.Error(w, "Authentication required", http.StatusUnauthorized)
 		return
@@ -221,7 +265,7 @@ func (s *Server) DeleteSessionHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = s.sessionStorage.DeleteSession(r.Context(), sessionID)
+	err = s.oauthService.EndSession(r.Context(), session)
 	if err != nil {
 		slog.Error("Failed to delete session", "error", err, "sessionId", sessionID)
 		http.Error(w, "Failed to delete session", http.StatusInternalServerError)
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/andyleap/passkey/internal/oauth"
+)
+
+// IntrospectHandler reports whether a token is active (RFC 7662)
+// POST /oauth/introspect
+func (oh *OAuthAPIHandlers) IntrospectHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Malformed form body")
+		return
+	}
+
+	clientAuth, err := clientAuthFromRequest(r, r.PostForm.Get("client_id"), r.PostForm.Get("client_secret"),
+		r.PostForm.Get("client_assertion_type"), r.PostForm.Get("client_assertion"))
+	if err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	result, err := oh.oauthService.IntrospectToken(r.Context(), token, r.PostForm.Get("token_type_hint"), clientAuth)
+	if errors.Is(err, oauth.ErrInvalidClient) {
+		writeInvalidClientError(w, clientAuth, err)
+		return
+	}
+	if err != nil {
+		slog.Error("Token introspection failed", "error", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(result)
+}
+
+// RevokeHandler revokes an access token, refresh token or session (RFC 7009)
+// POST /oauth/revoke
+func (oh *OAuthAPIHandlers) RevokeHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Malformed form body")
+		return
+	}
+
+	clientAuth, err := clientAuthFromRequest(r, r.PostForm.Get("client_id"), r.PostForm.Get("client_secret"),
+		r.PostForm.Get("client_assertion_type"), r.PostForm.Get("client_assertion"))
+	if err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	err = oh.oauthService.RevokeToken(r.Context(), token, r.PostForm.Get("token_type_hint"), clientAuth)
+	if errors.Is(err, oauth.ErrInvalidClient) {
+		writeInvalidClientError(w, clientAuth, err)
+		return
+	}
+	if err != nil {
+		slog.Error("Token revocation failed", "error", err)
+		writeOAuthError(w, http.StatusServiceUnavailable, "temporarily_unavailable", "")
+		return
+	}
+
+	// Unknown tokens get the same response so clients can't probe for them
+	w.WriteHeader(http.StatusOK)
+}
+
+// BackchannelLogoutAttemptsHandler lists the client's recent back-channel
+// logout deliveries and their outcomes
+// POST /oauth/backchannel_logout/attempts
+func (oh *OAuthAPIHandlers) BackchannelLogoutAttemptsHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Malformed form body")
+		return
+	}
+
+	clientAuth, err := clientAuthFromRequest(r, r.PostForm.Get("client_id"), r.PostForm.Get("client_secret"),
+		r.PostForm.Get("client_assertion_type"), r.PostForm.Get("client_assertion"))
+	if err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	attempts, err := oh.oauthService.BackchannelLogoutAttempts(r.Context(), clientAuth)
+	if errors.Is(err, oauth.ErrInvalidClient) {
+		writeInvalidClientError(w, clientAuth, err)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to list back-channel logout attempts", "error", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]any{
+		"attempts": attempts,
+	})
+}
@@ -2,121 +2,479 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"mime"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/andyleap/passkey/internal/models"
 	"github.com/andyleap/passkey/internal/oauth"
+	"github.com/andyleap/passkey/internal/storage"
 )
 
 type OAuthAPIHandlers struct {
-	oauthService *oauth.OAuthService
+	oauthService   *oauth.OAuthService
+	sessionStorage storage.SessionStorage
+	userStorage    storage.UserStorage
 }
 
-func NewOAuthAPIHandlers(oauthService *oauth.OAuthService) *OAuthAPIHandlers {
+func NewOAuthAPIHandlers(oauthService *oauth.OAuthService, sessionStorage storage.SessionStorage, userStorage storage.UserStorage) *OAuthAPIHandlers {
 	return &OAuthAPIHandlers{
-		oauthService: oauthService,
+		oauthService:   oauthService,
+		sessionStorage: sessionStorage,
+		userStorage:    userStorage,
 	}
 }
 
-// TokenHandler handles authorization code exchange
-// POST /token
+// tokenRequest holds the parameters of a token endpoint request
+type tokenRequest struct {
+	GrantType    string `json:"grant_type"`
+	Code         string `json:"code"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RedirectURI  string `json:"redirect_uri"`
+	CodeVerifier string `json:"code_verifier"`
+	DeviceCode   string `json:"device_code"`
+
+	// ClientAssertionType and ClientAssertion carry a private_key_jwt
+	// client assertion (RFC 7521 section 4.2)
+	ClientAssertionType string `json:"client_assertion_type"`
+	ClientAssertion     string `json:"client_assertion"`
+
+	// legacy is set for JSON bodies, as sent by integrations written before
+	// the endpoint accepted standard form posts
+	legacy bool
+}
+
+// TokenHandler handles authorization code exchange, refresh token, client
+// credentials and device code grants (RFC 6749 section 3.2). Requests are
+// application/x-www-form-urlencoded; a JSON body is still accepted for
+// earlier integrations.
+// POST /oauth/token
 func (oh *OAuthAPIHandlers) TokenHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var request struct {
-		Code        string `json:"code"`
-		ClientID    string `json:"client_id"`
-		RedirectURI string `json:"redirect_uri"`
+	request, err := parseTokenRequest(r)
+	if err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	clientAuth, err := clientAuthFromRequest(r, request.ClientID, request.ClientSecret, request.ClientAssertionType, request.ClientAssertion)
+	if err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", err.Error())
 		return
 	}
+	if clientAuth.ClientID == "" {
+		writeInvalidClientError(w, clientAuth, fmt.Errorf("no client credentials"))
+		return
+	}
+
+	// A DPoP proof binds the issued tokens to the client's key (RFC 9449
+	// section 5)
+	if len(r.Header.Values("DPoP")) > 0 {
+		clientAuth.DPoPJKT, err = dpopProof(w, r, oh.oauthService, "")
+		if err != nil {
+			writeTokenError(w, clientAuth, err)
+			return
+		}
+	}
+
+	switch request.GrantType {
+	case "authorization_code":
+		oh.exchangeAuthorizationCode(w, r, clientAuth, request)
+	case "refresh_token":
+		oh.refreshTokens(w, r, clientAuth, request)
+	case models.GrantTypeClientCredentials:
+		oh.issueClientCredentialsToken(w, r, clientAuth, request)
+	case oauth.DeviceCodeGrantType:
+		oh.exchangeDeviceCode(w, r, clientAuth, request)
+	default:
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+	}
+}
+
+// parseTokenRequest reads the token request from a form body, or from a JSON
+// body in legacy mode
+func parseTokenRequest(r *http.Request) (*tokenRequest, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	if mediaType != "application/x-www-form-urlencoded" {
+		var request tokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			return nil, fmt.Errorf("invalid JSON body")
+		}
+		request.legacy = true
+		if request.GrantType == "" {
+			// Earlier integrations omit grant_type
+			request.GrantType = "authorization_code"
+		}
+		return &request, nil
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return nil, fmt.Errorf("malformed form body")
+	}
 
-	if request.Code == "" || request.ClientID == "" || request.RedirectURI == "" {
-		http.Error(w, "code, client_id, and redirect_uri are required", http.StatusBadRequest)
+	// RFC 6749 section 3.2: parameters must not be included more than once
+	for name, values := range r.PostForm {
+		if len(values) > 1 {
+			return nil, fmt.Errorf("duplicate parameter %s", name)
+		}
+	}
+
+	request := &tokenRequest{
+		GrantType:    r.PostForm.Get("grant_type"),
+		Code:         r.PostForm.Get("code"),
+		RefreshToken: r.PostForm.Get("refresh_token"),
+		Scope:        r.PostForm.Get("scope"),
+		ClientID:     r.PostForm.Get("client_id"),
+		ClientSecret: r.PostForm.Get("client_secret"),
+		RedirectURI:  r.PostForm.Get("redirect_uri"),
+		CodeVerifier: r.PostForm.Get("code_verifier"),
+		DeviceCode:   r.PostForm.Get("device_code"),
+
+		ClientAssertionType: r.PostForm.Get("client_assertion_type"),
+		ClientAssertion:     r.PostForm.Get("client_assertion"),
+	}
+	if request.GrantType == "" {
+		return nil, fmt.Errorf("grant_type is required")
+	}
+
+	return request, nil
+}
+
+// exchangeAuthorizationCode handles grant_type=authorization_code
+func (oh *OAuthAPIHandlers) exchangeAuthorizationCode(w http.ResponseWriter, r *http.Request, clientAuth *oauth.ClientAuth, request *tokenRequest) {
+	if request.Code == "" || request.RedirectURI == "" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "code and redirect_uri are required")
 		return
 	}
 
 	// Exchange authorization code
-	authCode, err := oh.oauthService.ExchangeAuthorizationCode(r.Context(), request.Code, request.ClientID, request.RedirectURI)
+	authCode, err := oh.oauthService.ExchangeAuthorizationCode(r.Context(), request.Code, request.RedirectURI, request.CodeVerifier, clientAuth)
 	if err != nil {
-		slog.Error("Token exchange error", "error", err)
-		http.Error(w, "Invalid authorization code", http.StatusBadRequest)
+		writeTokenError(w, clientAuth, err)
 		return
 	}
 
-	// Return user information
-	response := map[string]any{
-		"username":   authCode.Username,
-		"user_id":    authCode.UserID,
-		"client_id":  authCode.ClientID,
-		"expires_at": authCode.ExpiresAt,
+	tokens, err := oh.oauthService.IssueTokens(r.Context(), authCode, clientAuth.DPoPJKT)
+	if err != nil {
+		writeTokenError(w, clientAuth, err)
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	response := tokenResponseBody(tokens)
+	if request.legacy {
+		// The user fields earlier integrations rely on
+		response["username"] = authCode.Username
+		response["user_id"] = authCode.UserID
+		response["client_id"] = authCode.ClientID
+		response["expires_at"] = authCode.ExpiresAt
+	}
+
+	writeTokenResponse(w, response)
 }
 
-// CompleteHandler completes OAuth flow after successful authentication
-// POST /oauth/complete
-func (oh *OAuthAPIHandlers) CompleteHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// refreshTokens handles grant_type=refresh_token
+func (oh *OAuthAPIHandlers) refreshTokens(w http.ResponseWriter, r *http.Request, clientAuth *oauth.ClientAuth, request *tokenRequest) {
+	if request.RefreshToken == "" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "refresh_token is required")
 		return
 	}
 
-	var request struct {
-		Username    string `json:"username"`
-		ClientID    string `json:"client_id"`
-		RedirectURI string `json:"redirect_uri"`
-		State       string `json:"state"`
+	tokens, err := oh.oauthService.RefreshTokens(r.Context(), request.RefreshToken, request.Scope, clientAuth)
+	if err != nil {
+		writeTokenError(w, clientAuth, err)
+		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	writeTokenResponse(w, tokenResponseBody(tokens))
+}
+
+// issueClientCredentialsToken handles grant_type=client_credentials
+func (oh *OAuthAPIHandlers) issueClientCredentialsToken(w http.ResponseWriter, r *http.Request, clientAuth *oauth.ClientAuth, request *tokenRequest) {
+	tokens, err := oh.oauthService.IssueClientCredentialsToken(r.Context(), request.Scope, clientAuth)
+	if err != nil {
+		writeTokenError(w, clientAuth, err)
 		return
 	}
 
-	if request.Username == "" || request.ClientID == "" || request.RedirectURI == "" {
-		http.Error(w, "username, client_id, and redirect_uri are required", http.StatusBadRequest)
+	writeTokenResponse(w, tokenResponseBody(tokens))
+}
+
+// exchangeDeviceCode handles grant_type=urn:ietf:params:oauth:grant-type:device_code
+func (oh *OAuthAPIHandlers) exchangeDeviceCode(w http.ResponseWriter, r *http.Request, clientAuth *oauth.ClientAuth, request *tokenRequest) {
+	if request.DeviceCode == "" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "device_code is required")
 		return
 	}
 
-	// Create authorization request to validate the client
-	authRequest, err := oh.oauthService.CreateAuthorizationRequest(request.ClientID, request.RedirectURI, request.State)
+	tokens, err := oh.oauthService.ExchangeDeviceCode(r.Context(), request.DeviceCode, clientAuth)
 	if err != nil {
-		slog.Error("Invalid authorization request", "error", err)
-		http.Error(w, "Invalid authorization request", http.StatusBadRequest)
+		writeTokenError(w, clientAuth, err)
+		return
+	}
+
+	writeTokenResponse(w, tokenResponseBody(tokens))
+}
+
+// DeviceAuthorizationHandler starts a device authorization grant (RFC 8628)
+// POST /oauth/device_authorization
+func (oh *OAuthAPIHandlers) DeviceAuthorizationHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "malformed form body")
 		return
 	}
 
-	// Create a minimal user object for the authorization code
-	user := &models.User{
-		ID:   []byte(request.Username),
-		Name: request.Username,
+	clientAuth, err := clientAuthFromRequest(r, r.PostForm.Get("client_id"), r.PostForm.Get("client_secret"),
+		r.PostForm.Get("client_assertion_type"), r.PostForm.Get("client_assertion"))
+	if err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if clientAuth.ClientID == "" {
+		writeInvalidClientError(w, clientAuth, fmt.Errorf("no client credentials"))
+		return
 	}
 
-	// Create authorization code
-	authCode, err := oh.oauthService.CreateAuthorizationCode(r.Context(), authRequest, user)
+	response, err := oh.oauthService.StartDeviceAuthorization(r.Context(), r.PostForm.Get("scope"), clientAuth)
 	if err != nil {
-		slog.Error("Failed to create authorization code", "error", err)
-		http.Error(w, "Failed to create authorization code", http.StatusInternalServerError)
+		writeTokenError(w, clientAuth, err)
 		return
 	}
 
-	// Build redirect URL with authorization code
-	redirectURL := oh.oauthService.BuildRedirectURL(request.RedirectURI, authCode.Code, request.State)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(response)
+}
 
-	response := map[string]string{
-		"redirect_url": redirectURL,
+// writeTokenError maps a service error to an RFC 6749 section 5.2 response
+func writeTokenError(w http.ResponseWriter, clientAuth *oauth.ClientAuth, err error) {
+	switch {
+	case errors.Is(err, oauth.ErrInvalidClient):
+		writeInvalidClientError(w, clientAuth, err)
+	case errors.Is(err, oauth.ErrInvalidGrant):
+		slog.Warn("Token request rejected", "client_id", clientAuth.ClientID, "error", err)
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "The grant is invalid, expired or revoked")
+	case errors.Is(err, oauth.ErrInvalidScope):
+		writeOAuthError(w, http.StatusBadRequest, "invalid_scope", err.Error())
+	case errors.Is(err, oauth.ErrUnauthorizedClient):
+		writeOAuthError(w, http.StatusBadRequest, "unauthorized_client", err.Error())
+	case errors.Is(err, oauth.ErrAuthorizationPending):
+		writeOAuthError(w, http.StatusBadRequest, "authorization_pending", "")
+	case errors.Is(err, oauth.ErrSlowDown):
+		writeOAuthError(w, http.StatusBadRequest, "slow_down", "")
+	case errors.Is(err, oauth.ErrAccessDenied):
+		writeOAuthError(w, http.StatusBadRequest, "access_denied", "The user denied the request")
+	case errors.Is(err, oauth.ErrExpiredToken):
+		writeOAuthError(w, http.StatusBadRequest, "expired_token", "The device code is invalid or has expired")
+	case errors.Is(err, oauth.ErrUseDPoPNonce):
+		writeOAuthError(w, http.StatusBadRequest, "use_dpop_nonce", "Authorization server requires nonce in DPoP proof")
+	case errors.Is(err, oauth.ErrInvalidDPoPProof):
+		writeOAuthError(w, http.StatusBadRequest, "invalid_dpop_proof", err.Error())
+	default:
+		slog.Error("Token request failed", "client_id", clientAuth.ClientID, "error", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
 	}
+}
 
+func tokenResponseBody(tokens *oauth.TokenResponse) map[string]any {
+	response := map[string]any{
+		"access_token": tokens.AccessToken,
+		"token_type":   tokens.TokenType,
+		"expires_in":   tokens.ExpiresIn,
+	}
+	if tokens.RefreshToken != "" {
+		response["refresh_token"] = tokens.RefreshToken
+	}
+	if tokens.Scope != "" {
+		response["scope"] = tokens.Scope
+	}
+	if tokens.IDToken != "" {
+		response["id_token"] = tokens.IDToken
+	}
+	return response
+}
+
+func writeTokenResponse(w http.ResponseWriter, response map[string]any) {
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
 	json.NewEncoder(w).Encode(response)
 }
+
+// writeOAuthError writes an RFC 6749 section 5.2 JSON error response
+func writeOAuthError(w http.ResponseWriter, status int, errorCode, description string) {
+	body := map[string]string{"error": errorCode}
+	if description != "" {
+		body["error_description"] = description
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeInvalidClientError answers a failed client authentication with 401 and
+// a Basic challenge
+func writeInvalidClientError(w http.ResponseWriter, clientAuth *oauth.ClientAuth, err error) {
+	slog.Warn("Client authentication failed", "client_id", clientAuth.ClientID, "error", err)
+	w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+}
+
+// clientAuthFromRequest collects client credentials from the Authorization
+// header (client_secret_basic) or the request body (client_secret_post and
+// private_key_jwt)
+func clientAuthFromRequest(r *http.Request, bodyClientID, bodyClientSecret, assertionType, assertion string) (*oauth.ClientAuth, error) {
+	if assertionType != "" || assertion != "" {
+		return clientAssertionAuth(r, bodyClientID, bodyClientSecret, assertionType, assertion)
+	}
+
+	if user, pass, ok := r.BasicAuth(); ok {
+		if bodyClientSecret != "" {
+			return nil, fmt.Errorf("multiple client authentication methods used")
+		}
+
+		// RFC 6749 section 2.3.1: credentials are form-encoded before base64
+		clientID, err := url.QueryUnescape(user)
+		if err != nil {
+			return nil, fmt.Errorf("malformed client credentials")
+		}
+		clientSecret, err := url.QueryUnescape(pass)
+		if err != nil {
+			return nil, fmt.Errorf("malformed client credentials")
+		}
+		if bodyClientID != "" && bodyClientID != clientID {
+			return nil, fmt.Errorf("client_id mismatch")
+		}
+
+		return &oauth.ClientAuth{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			Method:       models.AuthMethodClientSecretBasic,
+		}, nil
+	}
+
+	if bodyClientSecret != "" {
+		return &oauth.ClientAuth{
+			ClientID:     bodyClientID,
+			ClientSecret: bodyClientSecret,
+			Method:       models.AuthMethodClientSecretPost,
+		}, nil
+	}
+
+	return &oauth.ClientAuth{
+		ClientID: bodyClientID,
+		Method:   models.AuthMethodNone,
+	}, nil
+}
+
+// clientAssertionAuth collects a private_key_jwt client assertion (RFC 7521
+// section 4.2). The client_id is optional, since the assertion names the
+// client; the assertion itself is verified by the OAuth service.
+func clientAssertionAuth(r *http.Request, bodyClientID, bodyClientSecret, assertionType, assertion string) (*oauth.ClientAuth, error) {
+	if _, _, ok := r.BasicAuth(); ok || bodyClientSecret != "" {
+		return nil, fmt.Errorf("multiple client authentication methods used")
+	}
+	if assertionType != oauth.ClientAssertionTypeJWTBearer {
+		return nil, fmt.Errorf("unsupported client_assertion_type")
+	}
+	if assertion == "" {
+		return nil, fmt.Errorf("client_assertion is required")
+	}
+
+	clientID, err := oauth.ClientIDFromAssertion(assertion)
+	if err != nil {
+		return nil, err
+	}
+	if bodyClientID != "" && bodyClientID != clientID {
+		return nil, fmt.Errorf("client_id mismatch")
+	}
+
+	return &oauth.ClientAuth{
+		ClientID:        clientID,
+		ClientAssertion: assertion,
+		Method:          models.AuthMethodPrivateKeyJWT,
+	}, nil
+}
+
+// UserGrantsHandler returns the applications the user has granted access to
+// GET /api/v1/user/grants
+func (oh *OAuthAPIHandlers) UserGrantsHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := sessionFromRequest(w, r, oh.sessionStorage, oh.oauthService)
+	if err != nil {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	grants, err := oh.oauthService.ConsentGrants(r.Context(), session.Username)
+	if err != nil {
+		slog.Error("Failed to get consent grants", "error", err)
+		http.Error(w, "Failed to get grants", http.StatusInternalServerError)
+		return
+	}
+
+	safeGrants := make([]map[string]interface{}, len(grants))
+	for i, grant := range grants {
+		clientName := grant.ClientID
+		if client, exists := oh.oauthService.GetClient(r.Context(), grant.ClientID); exists {
+			clientName = client.Name
+		}
+		safeGrants[i] = map[string]interface{}{
+			"clientId":   grant.ClientID,
+			"clientName": clientName,
+			"scopes":     strings.Fields(grant.Scope),
+			"createdAt":  grant.CreatedAt,
+			"updatedAt":  grant.UpdatedAt,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"username": session.Username,
+		"grants":   safeGrants,
+	})
+}
+
+// DeleteGrantHandler revokes an application's access, including its refresh
+// tokens
+// DELETE /api/v1/user/grants/{clientId}
+func (oh *OAuthAPIHandlers) DeleteGrantHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := sessionFromRequest(w, r, oh.sessionStorage, oh.oauthService)
+	if err != nil {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	clientID := r.PathValue("clientId")
+	if clientID == "" {
+		http.Error(w, "Client ID required", http.StatusBadRequest)
+		return
+	}
+
+	err = oh.oauthService.RevokeConsent(r.Context(), session.Username, clientID)
+	if errors.Is(err, oauth.ErrConsentGrantNotFound) {
+		http.Error(w, "Grant not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to revoke consent grant", "error", err, "username", session.Username, "clientId", clientID)
+		http.Error(w, "Failed to revoke access", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "revoked"})
+}
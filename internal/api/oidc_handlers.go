@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/andyleap/passkey/internal/oauth"
+)
+
+// DiscoveryHandler serves the OpenID Provider configuration
+// GET /.well-known/openid-configuration
+func (oh *OAuthAPIHandlers) DiscoveryHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	json.NewEncoder(w).Encode(oh.oauthService.DiscoveryDocument())
+}
+
+// JWKSHandler serves the public keys used to verify ID tokens
+// GET /.well-known/jwks.json
+func (oh *OAuthAPIHandlers) JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(oh.oauthService.JWKS())
+}
+
+// UserInfoHandler returns claims about the user an access token was issued for.
+// DPoP-bound tokens must come with a proof of possession of their key.
+// GET/POST /oauth/userinfo
+func (oh *OAuthAPIHandlers) UserInfoHandler(w http.ResponseWriter, r *http.Request) {
+	scheme, token := accessTokenFromRequest(r)
+	if token == "" && r.Method == "POST" && strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		// RFC 6750 section 2.2: form-encoded body parameter
+		scheme, token = "Bearer", r.PostFormValue("access_token")
+	}
+	if token == "" {
+		writeBearerError(w, http.StatusUnauthorized, "", "", "")
+		return
+	}
+
+	accessToken, err := oh.oauthService.ValidateAccessToken(r.Context(), token)
+	if err == nil {
+		err = verifyTokenBinding(w, r, oh.oauthService, scheme, token, accessToken.DPoPJKT)
+	}
+	if err != nil {
+		writeResourceError(w, scheme, err)
+		return
+	}
+
+	if accessToken.IsClientToken() || !oauth.HasScope(accessToken.Scope, oauth.ScopeOpenID) {
+		writeBearerError(w, http.StatusForbidden, "insufficient_scope", "The access token was not granted the openid scope", oauth.ScopeOpenID)
+		return
+	}
+
+	user, err := oh.userStorage.GetUser(r.Context(), accessToken.Username)
+	if err != nil {
+		writeBearerError(w, http.StatusUnauthorized, "invalid_token", "The user no longer exists", "")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(oauth.UserInfoClaims(user, accessToken.Scope))
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer" header
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return auth[7:]
+	}
+	return ""
+}
+
+// writeBearerError writes an RFC 6750 error response with a WWW-Authenticate
+// challenge. With no error code only the realm is sent, as for requests that
+// carried no token at all.
+func writeBearerError(w http.ResponseWriter, status int, errorCode, description, scope string) {
+	challenge := `Bearer realm="passkey-auth"`
+	if errorCode != "" {
+		challenge += fmt.Sprintf(`, error="%s"`, errorCode)
+	}
+	if description != "" {
+		challenge += fmt.Sprintf(`, error_description="%s"`, description)
+	}
+	if scope != "" {
+		challenge += fmt.Sprintf(`, scope="%s"`, scope)
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+
+	if errorCode == "" {
+		w.WriteHeader(status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":             errorCode,
+		"error_description": description,
+	})
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/andyleap/passkey/internal/oauth"
+)
+
+// PushedAuthorizationRequestHandler accepts an authorization request straight
+// from the client and returns a request_uri to send the user to /authorize
+// with (RFC 9126)
+// POST /oauth/par
+func (oh *OAuthAPIHandlers) PushedAuthorizationRequestHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "malformed form body")
+		return
+	}
+	form := r.PostForm
+
+	clientAuth, err := clientAuthFromRequest(r, form.Get("client_id"), form.Get("client_secret"),
+		form.Get("client_assertion_type"), form.Get("client_assertion"))
+	if err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if clientAuth.ClientID == "" {
+		writeInvalidClientError(w, clientAuth, fmt.Errorf("no client credentials"))
+		return
+	}
+
+	// A pushed request can't itself refer to another one
+	if form.Get("request_uri") != "" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "request_uri is not allowed in a pushed authorization request")
+		return
+	}
+	if responseType := form.Get("response_type"); responseType != "" && responseType != "code" {
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_response_type", "only response_type=code is supported")
+		return
+	}
+
+	var maxAge *int
+	if value := form.Get("max_age"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_request", "max_age must be a number of seconds")
+			return
+		}
+		maxAge = &seconds
+	}
+
+	response, err := oh.oauthService.PushAuthorizationRequest(r.Context(), oauth.AuthorizationParams{
+		ClientID:            clientAuth.ClientID,
+		RedirectURI:         form.Get("redirect_uri"),
+		State:               form.Get("state"),
+		CodeChallenge:       form.Get("code_challenge"),
+		CodeChallengeMethod: form.Get("code_challenge_method"),
+		Scope:               form.Get("scope"),
+		Nonce:               form.Get("nonce"),
+		Prompt:              form.Get("prompt"),
+		MaxAge:              maxAge,
+		LoginHint:           form.Get("login_hint"),
+		ResponseMode:        form.Get("response_mode"),
+	}, clientAuth)
+	if err != nil {
+		var authErr *oauth.AuthorizationError
+		switch {
+		case errors.Is(err, oauth.ErrInvalidClient):
+			writeInvalidClientError(w, clientAuth, err)
+		case errors.As(err, &authErr):
+			writeOAuthError(w, http.StatusBadRequest, authErr.Code, authErr.Description)
+		default:
+			slog.Error("Pushed authorization request failed", "client_id", clientAuth.ClientID, "error", err)
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/andyleap/passkey/internal/oauth"
+)
+
+// RegisterClientHandler registers a client from its metadata (RFC 7591). The
+// request must carry the configured initial access token.
+// POST /oauth/register
+func (oh *OAuthAPIHandlers) RegisterClientHandler(w http.ResponseWriter, r *http.Request) {
+	var metadata oauth.ClientMetadata
+	if err := json.NewDecoder(r.Body).Decode(&metadata); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_client_metadata", "Malformed JSON body")
+		return
+	}
+
+	registration, err := oh.oauthService.RegisterClient(r.Context(), bearerToken(r), &metadata)
+	if err != nil {
+		writeRegistrationError(w, err)
+		return
+	}
+
+	writeClientRegistration(w, http.StatusCreated, registration)
+}
+
+// ClientConfigurationHandler returns a registered client's metadata (RFC 7592)
+// GET /oauth/register/{clientId}
+func (oh *OAuthAPIHandlers) ClientConfigurationHandler(w http.ResponseWriter, r *http.Request) {
+	registration, err := oh.oauthService.GetClientRegistration(r.Context(), r.PathValue("clientId"), bearerToken(r))
+	if err != nil {
+		writeRegistrationError(w, err)
+		return
+	}
+
+	writeClientRegistration(w, http.StatusOK, registration)
+}
+
+// UpdateClientConfigurationHandler replaces a registered client's metadata
+// PUT /oauth/register/{clientId}
+func (oh *OAuthAPIHandlers) UpdateClientConfigurationHandler(w http.ResponseWriter, r *http.Request) {
+	var metadata oauth.ClientMetadata
+	if err := json.NewDecoder(r.Body).Decode(&metadata); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_client_metadata", "Malformed JSON body")
+		return
+	}
+
+	registration, err := oh.oauthService.UpdateClientRegistration(r.Context(), r.PathValue("clientId"), bearerToken(r), &metadata)
+	if err != nil {
+		writeRegistrationError(w, err)
+		return
+	}
+
+	writeClientRegistration(w, http.StatusOK, registration)
+}
+
+// DeleteClientConfigurationHandler deletes a registered client
+// DELETE /oauth/register/{clientId}
+func (oh *OAuthAPIHandlers) DeleteClientConfigurationHandler(w http.ResponseWriter, r *http.Request) {
+	if err := oh.oauthService.DeleteClientRegistration(r.Context(), r.PathValue("clientId"), bearerToken(r)); err != nil {
+		writeRegistrationError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeClientRegistration(w http.ResponseWriter, status int, registration *oauth.ClientRegistration) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(registration)
+}
+
+// writeRegistrationError maps a registration error to an RFC 7591 section
+// 3.2.2 response, or a bearer challenge for a bad access token
+func writeRegistrationError(w http.ResponseWriter, err error) {
+	var registrationErr *oauth.RegistrationError
+	switch {
+	case errors.As(err, &registrationErr):
+		writeOAuthError(w, http.StatusBadRequest, registrationErr.Code, registrationErr.Description)
+	case errors.Is(err, oauth.ErrInvalidToken):
+		writeBearerError(w, http.StatusUnauthorized, "invalid_token", "The access token is invalid", "")
+	case errors.Is(err, oauth.ErrRegistrationDisabled):
+		http.Error(w, "Not found", http.StatusNotFound)
+	default:
+		slog.Error("Client registration failed", "error", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+	}
+}
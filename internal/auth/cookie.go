@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/andyleap/passkey/internal/models"
+)
+
+// SessionCookieName is the cookie a browser session's ID is kept in
+const SessionCookieName = "session_id"
+
+// SetSessionCookie hands a new session to the browser. The cookie is HttpOnly
+// so page scripts can't read it, and SameSite=Lax so the top-level
+// navigations client apps send users on, to /authorize or /oauth/logout,
+// carry it while cross-site posts don't.
+func SetSessionCookie(w http.ResponseWriter, session *models.Session) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    session.ID,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// ClearSessionCookie removes the session cookie after signing out
+func ClearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
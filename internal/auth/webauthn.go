@@ -15,17 +15,26 @@ import (
 	"github.com/go-webauthn/webauthn/webauthn"
 )
 
+// DPoPVerifier verifies DPoP proofs (RFC 9449), so that a client signing in
+// with one gets a session bound to its key
+type DPoPVerifier interface {
+	DPoPNonce(ctx context.Context) (string, error)
+	VerifyDPoPProof(ctx context.Context, method, path, proof, accessToken string) (string, error)
+}
+
 type WebAuthnService struct {
 	webauthn       *webauthn.WebAuthn
 	userStorage    storage.UserStorage
 	sessionStorage storage.SessionStorage
+	dpopVerifier   DPoPVerifier
 }
 
-func NewWebAuthnService(webauthn *webauthn.WebAuthn, userStorage storage.UserStorage, sessionStorage storage.SessionStorage) *WebAuthnService {
+func NewWebAuthnService(webauthn *webauthn.WebAuthn, userStorage storage.UserStorage, sessionStorage storage.SessionStorage, dpopVerifier DPoPVerifier) *WebAuthnService {
 	return &WebAuthnService{
 		webauthn:       webauthn,
 		userStorage:    userStorage,
 		sessionStorage: sessionStorage,
+		dpopVerifier:   dpopVerifier,
 	}
 }
 
@@ -77,14 +86,14 @@ func (w *WebAuthnService) BeginRegistration(ctx *http.Request, username string)
 	return options, nil
 }
 
-func (w *WebAuthnService) FinishRegistration(ctx *http.Request, username string) error {
+func (w *WebAuthnService) FinishRegistration(ctx *http.Request, username string) (*models.User, error) {
 	// First get the WebAuthn session to get the user that was created during BeginRegistration
 	session, err := w.sessionStorage.GetWebAuthnSession(ctx.Context(), username)
 	if err != nil {
-		return fmt.Errorf("failed to get webauthn session: %w", err)
+		return nil, fmt.Errorf("failed to get webauthn session: %w", err)
 	}
 	if session == nil {
-		return fmt.Errorf("session not found")
+		return nil, fmt.Errorf("session not found")
 	}
 
 	// Try to get existing user or create new one
@@ -104,28 +113,49 @@ func (w *WebAuthnService) FinishRegistration(ctx *http.Request, username string)
 		if len(user.Credentials) > 0 {
 			isAuthenticated := w.isUserAuthenticated(ctx, username)
 			if !isAuthenticated {
-				return fmt.Errorf("user already exists - please authenticate first to add additional passkeys")
+				return nil, fmt.Errorf("user already exists - please authenticate first to add additional passkeys")
 			}
 		}
 	}
 
 	credential, err := w.webauthn.FinishRegistration(user, *session.Data, ctx)
 	if err != nil {
-		return fmt.Errorf("failed to finish registration: %w", err)
+		return nil, fmt.Errorf("failed to finish registration: %w", err)
 	}
 
 	user.Credentials = append(user.Credentials, *credential)
 	user.UpdatedAt = time.Now()
 
 	if err := w.userStorage.SaveUser(ctx.Context(), user); err != nil {
-		return fmt.Errorf("failed to save user: %w", err)
+		return nil, fmt.Errorf("failed to save user: %w", err)
 	}
 
 	if err := w.sessionStorage.DeleteWebAuthnSession(ctx.Context(), username); err != nil {
-		return fmt.Errorf("failed to delete webauthn session: %w", err)
+		return nil, fmt.Errorf("failed to delete webauthn session: %w", err)
 	}
 
-	return nil
+	return user, nil
+}
+
+// createSession creates a user session after a successful passkey ceremony,
+// bound to the client's DPoP key if it sent a proof
+func (w *WebAuthnService) createSession(ctx context.Context, user *models.User, dpopJKT string) (*models.Session, error) {
+	now := time.Now()
+	session := &models.Session{
+		ID:        generateSessionID(),
+		Username:  user.Name,
+		UserID:    user.ID,
+		DPoPJKT:   dpopJKT,
+		AuthTime:  now,
+		CreatedAt: now,
+		ExpiresAt: now.Add(24 * time.Hour),
+	}
+
+	if err := w.sessionStorage.SaveSession(ctx, session); err != nil {
+		return nil, err
+	}
+
+	return session, nil
 }
 
 // BeginDiscoverableLogin starts a discoverable credential login flow (no username required)
@@ -249,6 +279,34 @@ func (w *WebAuthnService) isUserAuthenticated(ctx *http.Request, username string
 	return true
 }
 
+// setDPoPNonce hands out the nonce for the DPoP proof a client may send with
+// the finish request of a ceremony
+func (ws *WebAuthnService) setDPoPNonce(w http.ResponseWriter, r *http.Request) {
+	nonce, err := ws.dpopVerifier.DPoPNonce(r.Context())
+	if err != nil {
+		log.Printf("failed to get DPoP nonce: %v", err)
+		return
+	}
+	w.Header().Set("DPoP-Nonce", nonce)
+}
+
+// sessionBinding verifies the DPoP proof sent with a finish request, if any,
+// and returns the thumbprint of the key to bind the new session to. Browsers
+// don't send proofs and get unbound sessions.
+func (ws *WebAuthnService) sessionBinding(w http.ResponseWriter, r *http.Request) (string, error) {
+	proofs := r.Header.Values("DPoP")
+	if len(proofs) == 0 {
+		return "", nil
+	}
+
+	ws.setDPoPNonce(w, r)
+	if len(proofs) > 1 {
+		return "", fmt.Errorf("exactly one DPoP header is allowed")
+	}
+
+	return ws.dpopVerifier.VerifyDPoPProof(r.Context(), r.Method, r.URL.Path, proofs[0], "")
+}
+
 func (ws *WebAuthnService) RegisterBeginHandler(w http.ResponseWriter, r *http.Request) {
 	username := r.URL.Query().Get("username")
 	if username == "" {
@@ -262,6 +320,7 @@ func (ws *WebAuthnService) RegisterBeginHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	ws.setDPoPNonce(w, r)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(options)
 }
@@ -273,13 +332,36 @@ func (ws *WebAuthnService) RegisterFinishHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
-	if err := ws.FinishRegistration(r, username); err != nil {
+	// Checked before the ceremony is finished, so the client can retry
+	dpopJKT, err := ws.sessionBinding(w, r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("DPoP proof rejected: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	user, err := ws.FinishRegistration(r, username)
+	if err != nil {
 		http.Error(w, fmt.Sprintf("registration finish failed: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	// Sign the user in with the passkey they just created
+	session, err := ws.createSession(r.Context(), user, dpopJKT)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to create session: %v", err), http.StatusInternalServerError)
+		return
+	}
+	// Sessions bound to a DPoP key are only accepted with a proof, never
+	// from a cookie
+	if session.DPoPJKT == "" {
+		SetSessionCookie(w, session)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "registered"})
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":    "registered",
+		"sessionId": session.ID,
+	})
 }
 
 func (ws *WebAuthnService) LoginBeginHandler(w http.ResponseWriter, r *http.Request) {
@@ -290,6 +372,7 @@ func (ws *WebAuthnService) LoginBeginHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	ws.setDPoPNonce(w, r)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"publicKey": options.Response,
@@ -304,6 +387,13 @@ func (ws *WebAuthnService) LoginFinishHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	// Checked before the ceremony is finished, so the client can retry
+	dpopJKT, err := ws.sessionBinding(w, r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("DPoP proof rejected: %v", err), http.StatusBadRequest)
+		return
+	}
+
 	user, err := ws.FinishDiscoverableLogin(r, sessionID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("login finish failed: %v", err), http.StatusInternalServerError)
@@ -311,24 +401,21 @@ func (ws *WebAuthnService) LoginFinishHandler(w http.ResponseWriter, r *http.Req
 	}
 
 	// Create user session
-	userSessionID := generateSessionID()
-	session := &models.Session{
-		ID:        userSessionID,
-		Username:  user.Name,
-		UserID:    user.ID,
-		CreatedAt: time.Now(),
-		ExpiresAt: time.Now().Add(24 * time.Hour),
-	}
-
-	if err := ws.sessionStorage.SaveSession(r.Context(), session); err != nil {
+	session, err := ws.createSession(r.Context(), user, dpopJKT)
+	if err != nil {
 		http.Error(w, fmt.Sprintf("failed to create session: %v", err), http.StatusInternalServerError)
 		return
 	}
+	// Sessions bound to a DPoP key are only accepted with a proof, never
+	// from a cookie
+	if session.DPoPJKT == "" {
+		SetSessionCookie(w, session)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status":    "authenticated",
-		"sessionId": userSessionID,
+		"sessionId": session.ID,
 	})
 }
 
@@ -0,0 +1,330 @@
+package keys
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/andyleap/passkey/internal/models"
+	"github.com/andyleap/passkey/internal/storage"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// reloadInterval is how often the manager re-reads the key set from storage to
+// pick up rotations made by other replicas or the rotate command
+const reloadInterval = time.Minute
+
+// Manager keeps the signing key set: an active key used for signing, a next
+// key already published in the JWKS so relying parties cache it before it is
+// used, and retired keys published until the tokens they signed have expired.
+type Manager struct {
+	store          storage.KeyStorage
+	algorithm      string
+	rotationPeriod time.Duration
+	retention      time.Duration
+
+	mu        sync.RWMutex
+	active    *Signer
+	published []*Signer
+}
+
+// NewManager loads the key set from storage, creating it on first start
+func NewManager(ctx context.Context, store storage.KeyStorage, algorithm string, rotationPeriod, retention time.Duration) (*Manager, error) {
+	m := &Manager{
+		store:          store,
+		algorithm:      algorithm,
+		rotationPeriod: rotationPeriod,
+		retention:      retention,
+	}
+
+	keySet, err := m.loadKeySet(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.apply(keySet); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// NewStaticManager uses a single key read from disk. Static keys are never
+// rotated by the service.
+func NewStaticManager(algorithm, keyFile string) (*Manager, error) {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key file %s: %w", keyFile, err)
+	}
+
+	signer, err := NewSigner(algorithm, string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Manager{
+		algorithm: algorithm,
+		active:    signer,
+		published: []*Signer{signer},
+	}, nil
+}
+
+// Start periodically reloads the key set and rotates the active key when the
+// rotation period has elapsed. It returns when ctx is cancelled.
+func (m *Manager) Start(ctx context.Context) {
+	if m.store == nil {
+		return
+	}
+
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.refresh(ctx); err != nil {
+				slog.Error("Failed to refresh signing keys", "error", err)
+			}
+		}
+	}
+}
+
+// Rotate promotes the next key to active, retires the current active key and
+// generates a new next key
+func (m *Manager) Rotate(ctx context.Context) error {
+	if m.store == nil {
+		return fmt.Errorf("signing key is loaded from a file and cannot be rotated")
+	}
+
+	keySet, err := m.loadKeySet(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := m.rotate(keySet); err != nil {
+		return err
+	}
+
+	if err := m.store.SaveKeySet(ctx, keySet); err != nil {
+		return fmt.Errorf("failed to save key set: %w", err)
+	}
+
+	return m.apply(keySet)
+}
+
+// Sign signs the claims with the active key
+func (m *Manager) Sign(claims jwt.Claims) (string, error) {
+	m.mu.RLock()
+	active := m.active
+	m.mu.RUnlock()
+
+	return active.Sign(claims)
+}
+
+// SignWithType signs the claims with the active key and the given "typ" header
+func (m *Manager) SignWithType(claims jwt.Claims, typ string) (string, error) {
+	m.mu.RLock()
+	active := m.active
+	m.mu.RUnlock()
+
+	return active.SignWithType(claims, typ)
+}
+
+// Algorithm returns the JWS algorithm of the active key
+func (m *Manager) Algorithm() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.active.Algorithm()
+}
+
+// JWKS returns every published public key: active, next and retired
+func (m *Manager) JWKS() JWKS {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	jwks := JWKS{Keys: make([]JWK, 0, len(m.published))}
+	for _, signer := range m.published {
+		jwks.Keys = append(jwks.Keys, signer.JWK())
+	}
+	return jwks
+}
+
+// Keyfunc resolves the verification key for a token signed by this service
+func (m *Manager) Keyfunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, signer := range m.published {
+		if signer.ID() == kid {
+			if token.Method.Alg() != signer.Algorithm() {
+				return nil, fmt.Errorf("unexpected signing algorithm %s", token.Method.Alg())
+			}
+			return signer.PublicKey(), nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// refresh reloads the key set from storage and rotates it if it is due
+func (m *Manager) refresh(ctx context.Context) error {
+	keySet, err := m.loadKeySet(ctx)
+	if err != nil {
+		return err
+	}
+
+	if m.rotationDue(keySet) {
+		if err := m.rotate(keySet); err != nil {
+			return err
+		}
+		if err := m.store.SaveKeySet(ctx, keySet); err != nil {
+			return fmt.Errorf("failed to save key set: %w", err)
+		}
+		slog.Info("Rotated signing key", "kid", activeKey(keySet).ID)
+	}
+
+	return m.apply(keySet)
+}
+
+// loadKeySet reads the key set from storage, creating one if none exists
+func (m *Manager) loadKeySet(ctx context.Context) (*models.KeySet, error) {
+	keySet, err := m.store.GetKeySet(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load key set: %w", err)
+	}
+	if keySet != nil && activeKey(keySet) != nil {
+		return keySet, nil
+	}
+
+	active, err := GenerateKey(m.algorithm)
+	if err != nil {
+		return nil, err
+	}
+	active.Status = models.KeyStatusActive
+	active.ActivatedAt = active.CreatedAt
+
+	next, err := GenerateKey(m.algorithm)
+	if err != nil {
+		return nil, err
+	}
+	next.Status = models.KeyStatusNext
+
+	keySet = &models.KeySet{
+		Keys:      []*models.SigningKey{active, next},
+		UpdatedAt: time.Now(),
+	}
+
+	if err := m.store.SaveKeySet(ctx, keySet); err != nil {
+		return nil, fmt.Errorf("failed to save key set: %w", err)
+	}
+
+	return keySet, nil
+}
+
+func (m *Manager) rotationDue(keySet *models.KeySet) bool {
+	if m.rotationPeriod <= 0 {
+		return false
+	}
+	return time.Since(activeKey(keySet).ActivatedAt) >= m.rotationPeriod
+}
+
+// rotate updates the key set in place
+func (m *Manager) rotate(keySet *models.KeySet) error {
+	now := time.Now()
+
+	newNext, err := GenerateKey(m.algorithm)
+	if err != nil {
+		return err
+	}
+	newNext.Status = models.KeyStatusNext
+
+	kept := make([]*models.SigningKey, 0, len(keySet.Keys)+1)
+	promoted := false
+	for _, key := range keySet.Keys {
+		switch key.Status {
+		case models.KeyStatusActive:
+			key.Status = models.KeyStatusRetired
+			key.RetainUntil = now.Add(m.retention)
+		case models.KeyStatusNext:
+			if promoted {
+				continue
+			}
+			key.Status = models.KeyStatusActive
+			key.ActivatedAt = now
+			promoted = true
+		case models.KeyStatusRetired:
+			if now.After(key.RetainUntil) {
+				continue // Every token it signed has expired
+			}
+		}
+		kept = append(kept, key)
+	}
+
+	if !promoted {
+		// No next key was published; activate the new key directly
+		newNext.Status = models.KeyStatusActive
+		newNext.ActivatedAt = now
+		kept = append(kept, newNext)
+
+		another, err := GenerateKey(m.algorithm)
+		if err != nil {
+			return err
+		}
+		another.Status = models.KeyStatusNext
+		newNext = another
+	}
+
+	keySet.Keys = append(kept, newNext)
+	keySet.UpdatedAt = now
+	return nil
+}
+
+// apply parses the key set and makes it current
+func (m *Manager) apply(keySet *models.KeySet) error {
+	var active *Signer
+	published := make([]*Signer, 0, len(keySet.Keys))
+
+	now := time.Now()
+	for _, key := range keySet.Keys {
+		if key.Status == models.KeyStatusRetired && now.After(key.RetainUntil) {
+			continue
+		}
+
+		signer, err := NewSigner(key.Algorithm, key.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("failed to load signing key %s: %w", key.ID, err)
+		}
+		if key.Status == models.KeyStatusActive {
+			active = signer
+		}
+		published = append(published, signer)
+	}
+
+	if active == nil {
+		return fmt.Errorf("key set has no active signing key")
+	}
+
+	m.mu.Lock()
+	m.active = active
+	m.published = published
+	m.mu.Unlock()
+
+	return nil
+}
+
+func activeKey(keySet *models.KeySet) *models.SigningKey {
+	for _, key := range keySet.Keys {
+		if key.Status == models.KeyStatusActive {
+			return key
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+// Signing key lifecycle states
+const (
+	KeyStatusActive  = "active"
+	KeyStatusNext    = "next"
+	KeyStatusRetired = "retired"
+)
+
+// SigningKey is a private key used to sign ID tokens
+type SigningKey struct {
+	ID        string `json:"id"`
+	Algorithm string `json:"algorithm"`
+	// PrivateKey is the PEM-encoded PKCS#8 private key
+	PrivateKey string    `json:"privateKey"`
+	Status     string    `json:"status,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	// ActivatedAt is when the key started signing tokens
+	ActivatedAt time.Time `json:"activatedAt,omitempty"`
+	// RetainUntil is when a retired key may be removed from the JWKS, after
+	// every token it signed has expired
+	RetainUntil time.Time `json:"retainUntil,omitempty"`
+}
+
+// KeySet is the persisted state of all signing keys
+type KeySet struct {
+	Keys      []*SigningKey `json:"keys"`
+	UpdatedAt time.Time     `json:"updatedAt"`
+}
@@ -4,32 +4,246 @@ import (
 	"time"
 )
 
+// Access token formats
+const (
+	AccessTokenFormatOpaque = "opaque"
+	AccessTokenFormatJWT    = "jwt"
+)
+
+// GrantTypeClientCredentials is the grant of tokens a client obtains for
+// itself rather than for a user
+const GrantTypeClientCredentials = "client_credentials"
+
+// Authorization response modes
+const (
+	ResponseModeQuery    = "query"
+	ResponseModeFragment = "fragment"
+	ResponseModeFormPost = "form_post"
+)
+
+// Client authentication methods supported at the token endpoint
+const (
+	AuthMethodClientSecretBasic = "client_secret_basic"
+	AuthMethodClientSecretPost  = "client_secret_post"
+	AuthMethodPrivateKeyJWT     = "private_key_jwt"
+	AuthMethodNone              = "none"
+)
+
 // Client represents an OAuth client application
 type Client struct {
-	ID           string    `json:"id" yaml:"id"`
-	Name         string    `json:"name" yaml:"name"`
-	RedirectURIs []string  `json:"redirect_uris" yaml:"redirect_uris"`
-	CreatedAt    time.Time `json:"created_at" yaml:"created_at"`
+	ID           string   `json:"id" yaml:"id"`
+	Name         string   `json:"name" yaml:"name"`
+	RedirectURIs []string `json:"redirect_uris" yaml:"redirect_uris"`
+	// PostLogoutRedirectURIs are where the client may send users back to
+	// after signing them out at the end session endpoint
+	PostLogoutRedirectURIs []string `json:"post_logout_redirect_uris,omitempty" yaml:"post_logout_redirect_uris"`
+	// TokenEndpointAuthMethod is how the client authenticates at /oauth/token
+	TokenEndpointAuthMethod string `json:"token_endpoint_auth_method" yaml:"token_endpoint_auth_method"`
+	// ClientSecretHashes holds bcrypt or argon2id hashes of the client's
+	// secrets. Two entries may be active at once to allow rotation.
+	ClientSecretHashes []string `json:"client_secret_hashes,omitempty" yaml:"client_secret_hashes"`
+	// JWKS is the JSON Web Key Set a private_key_jwt client signs its client
+	// assertions with. Set either this or JWKSURI.
+	JWKS string `json:"jwks,omitempty" yaml:"jwks"`
+	// JWKSURI is where a private_key_jwt client publishes its key set
+	JWKSURI string `json:"jwks_uri,omitempty" yaml:"jwks_uri"`
+	// AllowedScopes limits the scopes the client may request
+	AllowedScopes []string `json:"allowed_scopes,omitempty" yaml:"allowed_scopes"`
+	// RequirePAR rejects authorization requests that weren't pushed to the
+	// pushed authorization request endpoint first (RFC 9126)
+	RequirePAR bool `json:"require_par,omitempty" yaml:"require_par"`
+	// RequireDPoP rejects token requests without a DPoP proof, so every
+	// token the client holds is bound to its key (RFC 9449)
+	RequireDPoP bool `json:"require_dpop,omitempty" yaml:"require_dpop"`
+	// RequirePKCE rejects authorization requests without a code_challenge
+	RequirePKCE bool `json:"require_pkce" yaml:"require_pkce"`
+	// AccessTokenFormat is "opaque" (default) or "jwt"
+	AccessTokenFormat string `json:"access_token_format" yaml:"access_token_format"`
+	// ResponseMode is how the authorization response is returned when the
+	// request has no response_mode: "query" (default), "fragment" or "form_post"
+	ResponseMode string `json:"response_mode" yaml:"response_mode"`
+	// BackchannelLogoutURI receives a logout token when a session the client
+	// was issued tokens in ends (OpenID Connect Back-Channel Logout)
+	BackchannelLogoutURI string `json:"backchannel_logout_uri,omitempty" yaml:"backchannel_logout_uri"`
+	// NativeApp enables the RFC 8252 redirect URI rules for desktop and
+	// mobile apps: any port on a loopback IP address, and private-use schemes
+	NativeApp bool `json:"native_app,omitempty" yaml:"native_app"`
+	// Disabled clients are rejected everywhere, as if they didn't exist
+	Disabled bool `json:"disabled,omitempty" yaml:"disabled"`
+	// RegistrationAccessTokenHash is the SHA-256 of the token a dynamically
+	// registered client manages its registration with (RFC 7592)
+	RegistrationAccessTokenHash string    `json:"registration_access_token_hash,omitempty" yaml:"-"`
+	CreatedAt                   time.Time `json:"created_at" yaml:"created_at"`
+}
+
+// IsConfidential reports whether the client must authenticate with a secret
+func (c *Client) IsConfidential() bool {
+	return c.TokenEndpointAuthMethod != "" && c.TokenEndpointAuthMethod != AuthMethodNone
+}
+
+// UsesClientSecret reports whether the client authenticates with a shared
+// secret rather than a signed client assertion
+func (c *Client) UsesClientSecret() bool {
+	return c.TokenEndpointAuthMethod == AuthMethodClientSecretBasic || c.TokenEndpointAuthMethod == AuthMethodClientSecretPost
 }
 
 // AuthorizationRequest represents an OAuth authorization request
 type AuthorizationRequest struct {
-	ClientID    string    `json:"client_id"`
-	RedirectURI string    `json:"redirect_uri"`
-	State       string    `json:"state"`
-	Username    string    `json:"username,omitempty"`
-	CreatedAt   time.Time `json:"created_at"`
-	ExpiresAt   time.Time `json:"expires_at"`
+	ID                  string    `json:"id"`
+	ClientID            string    `json:"client_id"`
+	RedirectURI         string    `json:"redirect_uri"`
+	State               string    `json:"state"`
+	CodeChallenge       string    `json:"code_challenge,omitempty"`
+	CodeChallengeMethod string    `json:"code_challenge_method,omitempty"`
+	Scope               string    `json:"scope,omitempty"`
+	Nonce               string    `json:"nonce,omitempty"`
+	Prompt              string    `json:"prompt,omitempty"`
+	MaxAge              *int      `json:"max_age,omitempty"`
+	LoginHint           string    `json:"login_hint,omitempty"`
+	ResponseMode        string    `json:"response_mode,omitempty"`
+	Username            string    `json:"username,omitempty"`
+	CreatedAt           time.Time `json:"created_at"`
+	ExpiresAt           time.Time `json:"expires_at"`
+}
+
+// PushedAuthorizationRequest holds the parameters a client sent to the pushed
+// authorization request endpoint until they are redeemed once at /authorize
+// by their request_uri (RFC 9126)
+type PushedAuthorizationRequest struct {
+	RequestURI          string    `json:"request_uri"`
+	ClientID            string    `json:"client_id"`
+	RedirectURI         string    `json:"redirect_uri"`
+	State               string    `json:"state"`
+	CodeChallenge       string    `json:"code_challenge,omitempty"`
+	CodeChallengeMethod string    `json:"code_challenge_method,omitempty"`
+	Scope               string    `json:"scope,omitempty"`
+	Nonce               string    `json:"nonce,omitempty"`
+	Prompt              string    `json:"prompt,omitempty"`
+	MaxAge              *int      `json:"max_age,omitempty"`
+	LoginHint           string    `json:"login_hint,omitempty"`
+	ResponseMode        string    `json:"response_mode,omitempty"`
+	CreatedAt           time.Time `json:"created_at"`
+	ExpiresAt           time.Time `json:"expires_at"`
 }
 
 // AuthorizationCode represents an authorization code
 type AuthorizationCode struct {
-	Code        string    `json:"code"`
-	ClientID    string    `json:"client_id"`
-	RedirectURI string    `json:"redirect_uri"`
-	State       string    `json:"state"`
-	Username    string    `json:"username"`
-	UserID      []byte    `json:"user_id"`
-	CreatedAt   time.Time `json:"created_at"`
-	ExpiresAt   time.Time `json:"expires_at"`
+	Code                string    `json:"code"`
+	ClientID            string    `json:"client_id"`
+	RedirectURI         string    `json:"redirect_uri"`
+	State               string    `json:"state"`
+	CodeChallenge       string    `json:"code_challenge,omitempty"`
+	CodeChallengeMethod string    `json:"code_challenge_method,omitempty"`
+	Scope               string    `json:"scope,omitempty"`
+	Nonce               string    `json:"nonce,omitempty"`
+	Username            string    `json:"username"`
+	UserID              []byte    `json:"user_id"`
+	SessionID           string    `json:"session_id,omitempty"`
+	AuthTime            time.Time `json:"auth_time"`
+	CreatedAt           time.Time `json:"created_at"`
+	ExpiresAt           time.Time `json:"expires_at"`
+}
+
+// Device authorization states
+const (
+	DeviceAuthorizationPending  = "pending"
+	DeviceAuthorizationApproved = "approved"
+	DeviceAuthorizationDenied   = "denied"
+)
+
+// DeviceAuthorization represents a device authorization grant (RFC 8628)
+// waiting for the user to enter the user code on another device
+type DeviceAuthorization struct {
+	DeviceCode string    `json:"device_code"`
+	UserCode   string    `json:"user_code"`
+	ClientID   string    `json:"client_id"`
+	Scope      string    `json:"scope,omitempty"`
+	Status     string    `json:"status"`
+	Username   string    `json:"username,omitempty"`
+	UserID     []byte    `json:"user_id,omitempty"`
+	SessionID  string    `json:"session_id,omitempty"`
+	AuthTime   time.Time `json:"auth_time,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// AccessToken represents a bearer token issued at the token endpoint. Token is
+// the opaque token value, or the "jti" of a JWT access token.
+type AccessToken struct {
+	Token    string `json:"token"`
+	FamilyID string `json:"family_id,omitempty"`
+	ClientID string `json:"client_id"`
+	Username string `json:"username"`
+	UserID   []byte `json:"user_id"`
+	Scope    string `json:"scope,omitempty"`
+	// GrantType is "client_credentials" for tokens issued to a client for
+	// itself, which have no user; empty for user tokens
+	GrantType string `json:"grant_type,omitempty"`
+	// DPoPJKT is the thumbprint of the key the token is bound to; the token
+	// is only accepted with a DPoP proof signed by that key
+	DPoPJKT   string    `json:"dpop_jkt,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// IsClientToken reports whether the token was issued to a client for itself
+// rather than on behalf of a user
+func (t *AccessToken) IsClientToken() bool {
+	return t.GrantType == GrantTypeClientCredentials
+}
+
+// RefreshToken represents a one-time-use refresh token. Each use issues a new
+// refresh token in the same family; replaying a used token revokes the family.
+type RefreshToken struct {
+	Token    string `json:"token"`
+	FamilyID string `json:"family_id"`
+	ClientID string `json:"client_id"`
+	Username string `json:"username"`
+	UserID   []byte `json:"user_id"`
+	Scope    string `json:"scope,omitempty"`
+	// SessionID is the session the user authorized the client in
+	SessionID string `json:"session_id,omitempty"`
+	// DPoPJKT binds a public client's refresh token to its DPoP key
+	DPoPJKT   string    `json:"dpop_jkt,omitempty"`
+	AuthTime  time.Time `json:"auth_time"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// Used is filled in by storage from the used marker, not persisted
+	Used bool `json:"-"`
+}
+
+// Outcomes of a back-channel logout delivery attempt
+const (
+	BackchannelLogoutDelivered = "delivered"
+	BackchannelLogoutRetrying  = "retrying"
+	BackchannelLogoutFailed    = "failed"
+)
+
+// BackchannelLogoutDelivery is a logout token delivery waiting in the queue.
+// The logout token is signed afresh for each attempt, so a delivery retried
+// after a restart doesn't carry an expired one.
+type BackchannelLogoutDelivery struct {
+	ID        string `json:"id"`
+	ClientID  string `json:"client_id"`
+	LogoutURI string `json:"logout_uri"`
+	Subject   string `json:"sub"`
+	SID       string `json:"sid"`
+	// Attempt is the number of the next attempt, starting at 1
+	Attempt       int       `json:"attempt"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// BackchannelLogoutAttempt records the outcome of one attempt to deliver a
+// logout token to a client
+type BackchannelLogoutAttempt struct {
+	ClientID string `json:"client_id"`
+	SID      string `json:"sid"`
+	Attempt  int    `json:"attempt"`
+	// Status is the HTTP status the client answered with, or 0 if the request
+	// failed before a response
+	Status  int       `json:"status,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Outcome string    `json:"outcome"`
+	Time    time.Time `json:"time"`
 }
@@ -7,13 +7,30 @@ import (
 )
 
 type Session struct {
-	ID        string    `json:"id"`
-	Username  string    `json:"username"`
-	UserID    []byte    `json:"userId"`
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	UserID   []byte `json:"userId"`
+	// ClientIDs are the clients that were issued tokens during the session,
+	// to notify when it ends. Filled in by storage, not persisted.
+	ClientIDs []string `json:"-"`
+	// DPoPJKT is the thumbprint of the DPoP key the session is bound to,
+	// for sessions a client signed in with a DPoP proof
+	DPoPJKT string `json:"dpopJkt,omitempty"`
+	// AuthTime is when the user performed the passkey ceremony
+	AuthTime  time.Time `json:"authTime"`
 	CreatedAt time.Time `json:"createdAt"`
 	ExpiresAt time.Time `json:"expiresAt"`
 }
 
+// AuthenticatedAt returns when the user authenticated, falling back to the
+// creation time for sessions stored before AuthTime was recorded
+func (s *Session) AuthenticatedAt() time.Time {
+	if s.AuthTime.IsZero() {
+		return s.CreatedAt
+	}
+	return s.AuthTime
+}
+
 type WebAuthnSession struct {
 	Username  string                `json:"username"`
 	Data      *webauthn.SessionData `json:"data"`
@@ -15,6 +15,16 @@ type User struct {
 	UpdatedAt   time.Time             `json:"updatedAt"`
 }
 
+// ConsentGrant records the scopes a user has approved for a client, so the
+// consent page can be skipped when the client asks for no more than that.
+// Grants are kept apart from the User record.
+type ConsentGrant struct {
+	ClientID  string    `json:"clientId"`
+	Scope     string    `json:"scope"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
 func (u User) WebAuthnID() []byte {
 	return u.ID
 }
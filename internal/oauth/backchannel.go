@@ -0,0 +1,281 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/andyleap/passkey/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// backchannelLogoutEvent identifies a logout token (OpenID Connect
+	// Back-Channel Logout 1.0 section 2.4)
+	backchannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+	// logoutTokenType is the JWT "typ" header of logout tokens
+	logoutTokenType     = "logout+jwt"
+	logoutTokenLifetime = 2 * time.Minute
+)
+
+// backchannelRetryDelays are the waits before each retry of a logout token
+// delivery that failed with a network error or a 5xx or 429 response
+var backchannelRetryDelays = []time.Duration{2 * time.Second, 10 * time.Second, 30 * time.Second}
+
+const (
+	// backchannelPollInterval is how often the delivery queue is checked for
+	// retries that are due
+	backchannelPollInterval = time.Second
+	// backchannelClaimLease is how long an instance has to attempt a claimed
+	// delivery before another instance may take it over. It outlasts the
+	// HTTP client timeout.
+	backchannelClaimLease = time.Minute
+)
+
+// SessionSID returns the "sid" claim identifying a session to clients. The
+// session ID itself is a bearer credential, so only a hash of it is shared.
+func SessionSID(sessionID string) string {
+	sum := sha256.Sum256([]byte("sid:" + sessionID))
+	return base64.RawURLEncoding.EncodeToString(sum[:16])
+}
+
+// ValidateBackchannelLogoutURI checks a client's backchannel_logout_uri,
+// which must be an absolute https URI without a fragment. Logout tokens carry
+// the user's subject, so plain http is only allowed on a loopback IP address,
+// as for native apps' redirect URIs.
+func ValidateBackchannelLogoutURI(logoutURI string) error {
+	u, err := url.Parse(logoutURI)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("must be an absolute https URI")
+	}
+	if u.Scheme == "http" && !isLoopbackIP(u.Hostname()) {
+		return fmt.Errorf("must use https unless the host is a loopback IP address")
+	}
+	if u.Fragment != "" {
+		return fmt.Errorf("must not contain a fragment")
+	}
+
+	return nil
+}
+
+// EndSession signs the user out of the session and notifies the clients that
+// were issued tokens during it
+func (o *OAuthService) EndSession(ctx context.Context, session *models.Session) error {
+	if err := o.sessionStorage.DeleteSession(ctx, session.ID); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+
+	o.notifyBackchannelLogout(ctx, session)
+	return nil
+}
+
+// recordSessionClient notes that a client was issued tokens in the session
+// the grant came from, so it hears when the session ends. Sessions that have
+// already ended are skipped.
+func (o *OAuthService) recordSessionClient(ctx context.Context, grant *tokenGrant) error {
+	if grant.SessionID == "" {
+		return nil
+	}
+
+	session, err := o.sessionStorage.GetSession(ctx, grant.SessionID)
+	if err != nil {
+		return fmt.Errorf("failed to get session: %w", err)
+	}
+	if session == nil {
+		return nil
+	}
+
+	if err := o.sessionStorage.AddSessionClient(ctx, session.ID, grant.ClientID, session.ExpiresAt); err != nil {
+		return fmt.Errorf("failed to record session client: %w", err)
+	}
+
+	return nil
+}
+
+// StartBackchannelLogout delivers queued logout tokens, retrying transient
+// failures, until ctx is cancelled. Deliveries are kept in session storage,
+// so those still pending when the process stops are picked up when it, or
+// another instance, starts again.
+func (o *OAuthService) StartBackchannelLogout(ctx context.Context) {
+	ticker := time.NewTicker(backchannelPollInterval)
+	defer ticker.Stop()
+
+	for {
+		o.deliverDueLogoutTokens(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-o.backchannelWake:
+		}
+	}
+}
+
+// BackchannelLogoutAttempts returns the recent attempts to deliver logout
+// tokens to a client, newest first. Only confidential clients may read their
+// delivery log.
+func (o *OAuthService) BackchannelLogoutAttempts(ctx context.Context, clientAuth *ClientAuth) ([]*models.BackchannelLogoutAttempt, error) {
+	client, err := o.AuthenticateClient(ctx, clientAuth)
+	if err != nil {
+		return nil, err
+	}
+	if !client.IsConfidential() {
+		return nil, fmt.Errorf("%w: reading the delivery log requires a confidential client", ErrInvalidClient)
+	}
+
+	attempts, err := o.sessionStorage.GetBackchannelLogoutAttempts(ctx, client.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get back-channel logout attempts: %w", err)
+	}
+
+	return attempts, nil
+}
+
+// notifyBackchannelLogout queues a logout token delivery to each of the
+// session's clients that registered a backchannel_logout_uri. Deliveries run
+// in the background so signing out isn't held up by slow clients.
+func (o *OAuthService) notifyBackchannelLogout(ctx context.Context, session *models.Session) {
+	now := time.Now()
+	for _, clientID := range session.ClientIDs {
+		client, err := o.lookupClient(ctx, clientID)
+		if err != nil {
+			slog.Error("Failed to look up client for back-channel logout", "client_id", clientID, "error", err)
+			continue
+		}
+		if client == nil || client.Disabled || client.BackchannelLogoutURI == "" {
+			continue
+		}
+
+		delivery := &models.BackchannelLogoutDelivery{
+			ID:            generateRandomCode(16),
+			ClientID:      client.ID,
+			LogoutURI:     client.BackchannelLogoutURI,
+			Subject:       Subject(session.UserID),
+			SID:           SessionSID(session.ID),
+			Attempt:       1,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		}
+		if err := o.sessionStorage.QueueBackchannelLogout(ctx, delivery); err != nil {
+			slog.Error("Failed to queue back-channel logout", "client_id", client.ID, "sid", delivery.SID, "error", err)
+		}
+	}
+
+	// Deliver now rather than at the next poll
+	select {
+	case o.backchannelWake <- struct{}{}:
+	default:
+	}
+}
+
+// deliverDueLogoutTokens claims the queued deliveries that are due and
+// attempts each of them
+func (o *OAuthService) deliverDueLogoutTokens(ctx context.Context) {
+	deliveries, err := o.sessionStorage.ClaimBackchannelLogouts(ctx, time.Now(), backchannelClaimLease)
+	if err != nil {
+		slog.Error("Failed to claim back-channel logout deliveries", "error", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		go o.deliverLogoutToken(ctx, delivery)
+	}
+}
+
+// signLogoutToken builds a logout token for a client (OpenID Connect
+// Back-Channel Logout 1.0 section 2.4)
+func (o *OAuthService) signLogoutToken(clientID, subject, sid string) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss": o.options.Issuer,
+		"sub": subject,
+		"aud": clientID,
+		"iat": now.Unix(),
+		"exp": now.Add(logoutTokenLifetime).Unix(),
+		"jti": generateRandomCode(16),
+		"sid": sid,
+		"events": map[string]any{
+			backchannelLogoutEvent: map[string]any{},
+		},
+	}
+
+	return o.keyManager.SignWithType(claims, logoutTokenType)
+}
+
+// deliverLogoutToken makes one attempt at a queued delivery, records its
+// outcome in the client's delivery log, and queues a retry after a transient
+// failure
+func (o *OAuthService) deliverLogoutToken(ctx context.Context, delivery *models.BackchannelLogoutDelivery) {
+	attempt := &models.BackchannelLogoutAttempt{
+		ClientID: delivery.ClientID,
+		SID:      delivery.SID,
+		Attempt:  delivery.Attempt,
+	}
+
+	retryable := false
+	logoutToken, err := o.signLogoutToken(delivery.ClientID, delivery.Subject, delivery.SID)
+	if err == nil {
+		body := url.Values{"logout_token": {logoutToken}}.Encode()
+		attempt.Status, err = o.postLogoutToken(delivery.LogoutURI, body)
+		retryable = err != nil || attempt.Status >= 500 || attempt.Status == http.StatusTooManyRequests
+		if err == nil && (attempt.Status < 200 || attempt.Status >= 300) {
+			err = fmt.Errorf("client responded with status %d", attempt.Status)
+		}
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+
+	logArgs := []any{"client_id", delivery.ClientID, "sid", delivery.SID, "attempt", delivery.Attempt, "status", attempt.Status}
+	switch {
+	case err == nil:
+		attempt.Outcome = models.BackchannelLogoutDelivered
+		slog.Info("Delivered back-channel logout", logArgs...)
+	case retryable && delivery.Attempt <= len(backchannelRetryDelays):
+		attempt.Outcome = models.BackchannelLogoutRetrying
+		delay := backchannelRetryDelays[delivery.Attempt-1]
+		slog.Warn("Back-channel logout attempt failed, retrying", append(logArgs, "error", err, "retry_in", delay)...)
+		delivery.Attempt++
+		delivery.NextAttemptAt = time.Now().Add(delay)
+	default:
+		attempt.Outcome = models.BackchannelLogoutFailed
+		slog.Error("Back-channel logout failed", append(logArgs, "error", err)...)
+	}
+
+	attempt.Time = time.Now()
+	if err := o.sessionStorage.RecordBackchannelLogoutAttempt(ctx, attempt); err != nil {
+		slog.Error("Failed to record back-channel logout attempt", "client_id", delivery.ClientID, "error", err)
+	}
+
+	if attempt.Outcome == models.BackchannelLogoutRetrying {
+		err = o.sessionStorage.QueueBackchannelLogout(ctx, delivery)
+	} else {
+		err = o.sessionStorage.CompleteBackchannelLogout(ctx, delivery.ID)
+	}
+	if err != nil {
+		slog.Error("Failed to update back-channel logout delivery", "client_id", delivery.ClientID, "error", err)
+	}
+}
+
+func (o *OAuthService) postLogoutToken(logoutURI, body string) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, logoutURI, strings.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,32 @@
+package oauth
+
+import "testing"
+
+func TestValidateBackchannelLogoutURI(t *testing.T) {
+	tests := []struct {
+		name      string
+		logoutURI string
+		wantErr   bool
+	}{
+		{name: "https", logoutURI: "https://app.example.com/backchannel-logout"},
+		{name: "loopback http", logoutURI: "http://127.0.0.1:8080/backchannel-logout"},
+		{name: "IPv6 loopback http", logoutURI: "http://[::1]:8080/backchannel-logout"},
+		{name: "http", logoutURI: "http://app.example.com/backchannel-logout", wantErr: true},
+		{name: "localhost http", logoutURI: "http://localhost:8080/backchannel-logout", wantErr: true},
+		{name: "other scheme", logoutURI: "com.example.app:/backchannel-logout", wantErr: true},
+		{name: "relative", logoutURI: "/backchannel-logout", wantErr: true},
+		{name: "fragment", logoutURI: "https://app.example.com/backchannel-logout#frag", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateBackchannelLogoutURI(tt.logoutURI)
+			if tt.wantErr && err == nil {
+				t.Error("ValidateBackchannelLogoutURI() = nil, want error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("ValidateBackchannelLogoutURI() error = %v", err)
+			}
+		})
+	}
+}
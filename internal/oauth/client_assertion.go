@@ -0,0 +1,298 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/andyleap/passkey/internal/keys"
+	"github.com/andyleap/passkey/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ClientAssertionTypeJWTBearer is the client_assertion_type of a JWT client
+// assertion (RFC 7523 section 2.2)
+const ClientAssertionTypeJWTBearer = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+const (
+	// maxClientAssertionLifetime bounds how far ahead a client assertion may
+	// expire, and so how long its jti has to be remembered
+	maxClientAssertionLifetime = time.Hour
+	// clientAssertionLeeway allows for clock skew between client and server
+	clientAssertionLeeway = 30 * time.Second
+	// jwksCacheLifetime is how long a key set fetched from a jwks_uri is used
+	jwksCacheLifetime = 10 * time.Minute
+	// jwksRefetchInterval limits refetches when an assertion is signed with
+	// a key the cached set doesn't have, as after a key rotation
+	jwksRefetchInterval = time.Minute
+	// maxJWKSSize caps the size of a key set fetched from a jwks_uri
+	maxJWKSSize = 1 << 20
+)
+
+// clientAssertionAlgorithms are the JWS algorithms accepted for client
+// assertions. "none" and the HMAC algorithms are never accepted.
+var clientAssertionAlgorithms = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+// ClientIDFromAssertion returns the client a client assertion claims to be
+// from, without verifying it, for requests that don't also send client_id
+func ClientIDFromAssertion(assertion string) (string, error) {
+	var claims jwt.RegisteredClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(assertion, &claims); err != nil {
+		return "", fmt.Errorf("malformed client assertion")
+	}
+	if claims.Subject == "" {
+		return "", fmt.Errorf("client assertion has no subject")
+	}
+
+	return claims.Subject, nil
+}
+
+// ValidateClientJWKS checks that an inline key set parses and holds at least
+// one signing key, all of them usable
+func ValidateClientJWKS(data string) error {
+	jwks, err := parseJWKS([]byte(data))
+	if err != nil {
+		return err
+	}
+
+	signingKeys := 0
+	for _, jwk := range jwks.Keys {
+		if jwk.Use == "enc" {
+			continue
+		}
+		if _, err := jwk.PublicKey(); err != nil {
+			return fmt.Errorf("key %q: %w", jwk.Kid, err)
+		}
+		signingKeys++
+	}
+	if signingKeys == 0 {
+		return fmt.Errorf("no signing keys")
+	}
+
+	return nil
+}
+
+// ValidateJWKSURI checks a client's jwks_uri, which must be an absolute http
+// or https URI without a fragment
+func ValidateJWKSURI(jwksURI string) error {
+	u, err := url.Parse(jwksURI)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("must be an absolute http or https URI")
+	}
+	if u.Fragment != "" {
+		return fmt.Errorf("must not contain a fragment")
+	}
+
+	return nil
+}
+
+// verifyClientAssertion checks a private_key_jwt client assertion (RFC 7523
+// section 3) and records its jti so it can't be replayed
+func (o *OAuthService) verifyClientAssertion(ctx context.Context, client *models.Client, assertion string) error {
+	if assertion == "" {
+		return fmt.Errorf("%w: client assertion is required", ErrInvalidClient)
+	}
+
+	parsed, err := jwt.Parse(assertion, o.clientAssertionKeyfunc(ctx, client),
+		jwt.WithValidMethods(clientAssertionAlgorithms),
+		jwt.WithIssuer(client.ID),
+		jwt.WithSubject(client.ID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(clientAssertionLeeway),
+	)
+	if err != nil {
+		return fmt.Errorf("%w: invalid client assertion: %v", ErrInvalidClient, err)
+	}
+
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok {
+		return fmt.Errorf("%w: unexpected client assertion claims", ErrInvalidClient)
+	}
+
+	audiences, _ := claims.GetAudience()
+	if !slices.ContainsFunc(audiences, o.isClientAssertionAudience) {
+		return fmt.Errorf("%w: client assertion audience must be the issuer or token endpoint", ErrInvalidClient)
+	}
+
+	expiresAt, _ := claims.GetExpirationTime()
+	if time.Until(expiresAt.Time) > maxClientAssertionLifetime {
+		return fmt.Errorf("%w: client assertion expires too far in the future", ErrInvalidClient)
+	}
+
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return fmt.Errorf("%w: client assertion has no jti", ErrInvalidClient)
+	}
+
+	// Remember the jti for as long as the assertion would be accepted
+	replayed, err := o.sessionStorage.MarkClientAssertionUsed(ctx, client.ID, jti, expiresAt.Add(clientAssertionLeeway))
+	if err != nil {
+		return fmt.Errorf("failed to record client assertion: %w", err)
+	}
+	if replayed {
+		return fmt.Errorf("%w: client assertion has already been used", ErrInvalidClient)
+	}
+
+	return nil
+}
+
+// isClientAssertionAudience reports whether an assertion "aud" identifies
+// this server. The issuer and the token endpoint are accepted everywhere, as
+// are the other endpoints that authenticate clients.
+func (o *OAuthService) isClientAssertionAudience(audience string) bool {
+	issuer := o.options.Issuer
+	switch audience {
+	case issuer,
+		issuer + "/oauth/token",
+		issuer + "/oauth/introspect",
+		issuer + "/oauth/revoke",
+		issuer + "/oauth/par",
+		issuer + "/oauth/device_authorization":
+		return true
+	}
+	return false
+}
+
+// clientAssertionKeyfunc resolves the client's keys that could have signed
+// the assertion, refetching a jwks_uri once if none match
+func (o *OAuthService) clientAssertionKeyfunc(ctx context.Context, client *models.Client) jwt.Keyfunc {
+	return func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		alg := token.Method.Alg()
+
+		jwks, err := o.clientJWKS(ctx, client, false)
+		if err != nil {
+			return nil, err
+		}
+		candidates := matchingKeys(jwks, kid, alg)
+
+		if len(candidates) == 0 && client.JWKSURI != "" {
+			jwks, err = o.clientJWKS(ctx, client, true)
+			if err != nil {
+				return nil, err
+			}
+			candidates = matchingKeys(jwks, kid, alg)
+		}
+
+		if len(candidates) == 0 {
+			return nil, fmt.Errorf("no key matches kid %q and alg %s", kid, alg)
+		}
+		return jwt.VerificationKeySet{Keys: candidates}, nil
+	}
+}
+
+// matchingKeys returns the signing keys in the set that fit the assertion's
+// kid and alg headers
+func matchingKeys(jwks *keys.JWKS, kid, alg string) []jwt.VerificationKey {
+	var candidates []jwt.VerificationKey
+	for _, jwk := range jwks.Keys {
+		if jwk.Use == "enc" || (kid != "" && jwk.Kid != kid) || (jwk.Alg != "" && jwk.Alg != alg) {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			continue
+		}
+		candidates = append(candidates, key)
+	}
+	return candidates
+}
+
+// clientJWKS returns the client's key set, from its configuration or its
+// jwks_uri. With refresh set, a cached jwks_uri response is refetched unless
+// it was fetched within jwksRefetchInterval.
+func (o *OAuthService) clientJWKS(ctx context.Context, client *models.Client, refresh bool) (*keys.JWKS, error) {
+	if client.JWKS != "" {
+		return parseJWKS([]byte(client.JWKS))
+	}
+	if client.JWKSURI == "" {
+		return nil, fmt.Errorf("client has no jwks or jwks_uri")
+	}
+
+	return o.jwksCache.get(ctx, o.httpClient, client.JWKSURI, refresh)
+}
+
+func parseJWKS(data []byte) (*keys.JWKS, error) {
+	var jwks keys.JWKS
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("malformed JWKS: %w", err)
+	}
+	return &jwks, nil
+}
+
+// jwksCache holds key sets fetched from clients' jwks_uri
+type jwksCache struct {
+	mu      sync.Mutex
+	entries map[string]*jwksCacheEntry
+}
+
+type jwksCacheEntry struct {
+	jwks      *keys.JWKS
+	fetchedAt time.Time
+}
+
+func newJWKSCache() *jwksCache {
+	return &jwksCache{entries: make(map[string]*jwksCacheEntry)}
+}
+
+// get returns the key set published at uri, fetching it if the cached copy
+// is missing, stale or, with refresh set, at least jwksRefetchInterval old
+func (c *jwksCache) get(ctx context.Context, httpClient *http.Client, uri string, refresh bool) (*keys.JWKS, error) {
+	c.mu.Lock()
+	entry := c.entries[uri]
+	c.mu.Unlock()
+
+	if entry != nil {
+		age := time.Since(entry.fetchedAt)
+		if age < jwksCacheLifetime && (!refresh || age < jwksRefetchInterval) {
+			return entry.jwks, nil
+		}
+	}
+
+	jwks, err := fetchJWKS(ctx, httpClient, uri)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.entries[uri] = &jwksCacheEntry{jwks: jwks, fetchedAt: time.Now()}
+	c.mu.Unlock()
+
+	return jwks, nil
+}
+
+func fetchJWKS(ctx context.Context, httpClient *http.Client, uri string) (*keys.JWKS, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jwks_uri: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch jwks_uri: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwks_uri returned status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read jwks_uri: %w", err)
+	}
+
+	return parseJWKS(data)
+}
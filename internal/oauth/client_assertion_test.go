@@ -0,0 +1,261 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andyleap/passkey/internal/keys"
+	"github.com/andyleap/passkey/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testIssuer = "https://auth.example.com"
+
+func newTestSigner(t *testing.T, algorithm string) *keys.Signer {
+	t.Helper()
+
+	key, err := keys.GenerateKey(algorithm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := keys.NewSigner(algorithm, key.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func marshalJWKS(t *testing.T, signers ...*keys.Signer) string {
+	t.Helper()
+
+	var jwks keys.JWKS
+	for _, signer := range signers {
+		jwks.Keys = append(jwks.Keys, signer.JWK())
+	}
+	data, err := json.Marshal(jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// newAssertionService returns a test service with the issuer set, and
+// registers a private_key_jwt client "jwt-client" configured by setup
+func newAssertionService(t *testing.T, setup func(client *models.Client)) *OAuthService {
+	t.Helper()
+
+	o, _ := newTestService(t)
+	o.options.Issuer = testIssuer
+
+	client := &models.Client{
+		ID:                      "jwt-client",
+		Name:                    "JWT Client",
+		RedirectURIs:            []string{"https://jwt.example.com/callback"},
+		TokenEndpointAuthMethod: models.AuthMethodPrivateKeyJWT,
+	}
+	setup(client)
+	if err := o.clientStorage.SaveClient(context.Background(), client); err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+func assertionClaims(jti string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss": "jwt-client",
+		"sub": "jwt-client",
+		"aud": testIssuer + "/oauth/token",
+		"iat": now.Unix(),
+		"exp": now.Add(5 * time.Minute).Unix(),
+		"jti": jti,
+	}
+}
+
+func signAssertion(t *testing.T, signer *keys.Signer, claims jwt.MapClaims) string {
+	t.Helper()
+
+	assertion, err := signer.Sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return assertion
+}
+
+func authenticateWithAssertion(o *OAuthService, assertion string) error {
+	_, err := o.AuthenticateClient(context.Background(), &ClientAuth{
+		ClientID:        "jwt-client",
+		ClientAssertion: assertion,
+		Method:          models.AuthMethodPrivateKeyJWT,
+	})
+	return err
+}
+
+func TestClientAssertion(t *testing.T) {
+	es256 := newTestSigner(t, keys.AlgES256)
+	rs256 := newTestSigner(t, keys.AlgRS256)
+	unregistered := newTestSigner(t, keys.AlgES256)
+	jwks := marshalJWKS(t, es256, rs256)
+
+	withClaim := func(name string, value any) func(jwt.MapClaims) {
+		return func(claims jwt.MapClaims) {
+			if value == nil {
+				delete(claims, name)
+				return
+			}
+			claims[name] = value
+		}
+	}
+
+	tests := []struct {
+		name    string
+		signer  *keys.Signer
+		modify  func(jwt.MapClaims)
+		wantErr bool
+	}{
+		{name: "ES256", signer: es256},
+		{name: "RS256", signer: rs256},
+		{name: "issuer audience", signer: es256, modify: withClaim("aud", testIssuer)},
+		{name: "introspection audience", signer: es256, modify: withClaim("aud", testIssuer+"/oauth/introspect")},
+		{name: "audience list", signer: es256, modify: withClaim("aud", []string{"https://other.example.com", testIssuer})},
+		{name: "wrong audience", signer: es256, modify: withClaim("aud", "https://other.example.com"), wantErr: true},
+		{name: "missing audience", signer: es256, modify: withClaim("aud", nil), wantErr: true},
+		{name: "wrong issuer", signer: es256, modify: withClaim("iss", "other-client"), wantErr: true},
+		{name: "wrong subject", signer: es256, modify: withClaim("sub", "other-client"), wantErr: true},
+		{name: "missing subject", signer: es256, modify: withClaim("sub", nil), wantErr: true},
+		{name: "expires within an hour", signer: es256, modify: withClaim("exp", time.Now().Add(59*time.Minute).Unix())},
+		{name: "expires after an hour", signer: es256, modify: withClaim("exp", time.Now().Add(2*time.Hour).Unix()), wantErr: true},
+		{name: "expired", signer: es256, modify: withClaim("exp", time.Now().Add(-time.Minute).Unix()), wantErr: true},
+		{name: "missing exp", signer: es256, modify: withClaim("exp", nil), wantErr: true},
+		{name: "missing jti", signer: es256, modify: withClaim("jti", nil), wantErr: true},
+		{name: "unregistered key", signer: unregistered, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newAssertionService(t, func(client *models.Client) { client.JWKS = jwks })
+
+			claims := assertionClaims(tt.name)
+			if tt.modify != nil {
+				tt.modify(claims)
+			}
+
+			err := authenticateWithAssertion(o, signAssertion(t, tt.signer, claims))
+			if tt.wantErr && err == nil {
+				t.Error("AuthenticateClient() = nil, want error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("AuthenticateClient() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestClientAssertionAlgorithms(t *testing.T) {
+	es256 := newTestSigner(t, keys.AlgES256)
+	o := newAssertionService(t, func(client *models.Client) { client.JWKS = marshalJWKS(t, es256) })
+
+	none := jwt.NewWithClaims(jwt.SigningMethodNone, assertionClaims("none"))
+	none.Header["kid"] = es256.ID()
+	noneAssertion, err := none.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An HMAC assertion keyed with the public key must not be accepted
+	hmac := jwt.NewWithClaims(jwt.SigningMethodHS256, assertionClaims("hmac"))
+	hmac.Header["kid"] = es256.ID()
+	jwk := es256.JWK()
+	hmacAssertion, err := hmac.SignedString([]byte(jwk.X + jwk.Y))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, assertion := range map[string]string{"none": noneAssertion, "HS256": hmacAssertion} {
+		if err := authenticateWithAssertion(o, assertion); err == nil {
+			t.Errorf("AuthenticateClient() with %s = nil, want error", name)
+		}
+	}
+}
+
+func TestClientAssertionReplay(t *testing.T) {
+	signer := newTestSigner(t, keys.AlgES256)
+	o := newAssertionService(t, func(client *models.Client) { client.JWKS = marshalJWKS(t, signer) })
+
+	assertion := signAssertion(t, signer, assertionClaims("replayed"))
+	if err := authenticateWithAssertion(o, assertion); err != nil {
+		t.Fatalf("AuthenticateClient() error = %v", err)
+	}
+	if err := authenticateWithAssertion(o, assertion); err == nil {
+		t.Error("AuthenticateClient() with a replayed assertion = nil, want error")
+	}
+
+	// A new jti is accepted
+	if err := authenticateWithAssertion(o, signAssertion(t, signer, assertionClaims("fresh"))); err != nil {
+		t.Errorf("AuthenticateClient() error = %v", err)
+	}
+}
+
+func TestClientAssertionJWKSURIRefetch(t *testing.T) {
+	oldKey := newTestSigner(t, keys.AlgES256)
+	newKey := newTestSigner(t, keys.AlgES256)
+
+	var mu sync.Mutex
+	published := marshalJWKS(t, oldKey)
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fetches++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(published))
+	}))
+	defer server.Close()
+
+	fetchCount := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return fetches
+	}
+
+	o := newAssertionService(t, func(client *models.Client) { client.JWKSURI = server.URL })
+
+	if err := authenticateWithAssertion(o, signAssertion(t, oldKey, assertionClaims("first"))); err != nil {
+		t.Fatalf("AuthenticateClient() error = %v", err)
+	}
+	if err := authenticateWithAssertion(o, signAssertion(t, oldKey, assertionClaims("cached"))); err != nil {
+		t.Fatalf("AuthenticateClient() error = %v", err)
+	}
+	if got := fetchCount(); got != 1 {
+		t.Fatalf("jwks_uri fetched %d times, want 1", got)
+	}
+
+	// The client rotates its key
+	mu.Lock()
+	published = marshalJWKS(t, newKey)
+	mu.Unlock()
+
+	// A key set fetched within the refetch interval isn't fetched again
+	if err := authenticateWithAssertion(o, signAssertion(t, newKey, assertionClaims("too-soon"))); err == nil {
+		t.Error("AuthenticateClient() before the refetch interval = nil, want error")
+	}
+	if got := fetchCount(); got != 1 {
+		t.Fatalf("jwks_uri fetched %d times, want 1", got)
+	}
+
+	o.jwksCache.mu.Lock()
+	o.jwksCache.entries[server.URL].fetchedAt = time.Now().Add(-jwksRefetchInterval)
+	o.jwksCache.mu.Unlock()
+
+	if err := authenticateWithAssertion(o, signAssertion(t, newKey, assertionClaims("rotated"))); err != nil {
+		t.Fatalf("AuthenticateClient() after rotation error = %v", err)
+	}
+	if got := fetchCount(); got != 2 {
+		t.Errorf("jwks_uri fetched %d times, want 2", got)
+	}
+}
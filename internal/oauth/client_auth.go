@@ -0,0 +1,148 @@
+package oauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/andyleap/passkey/internal/models"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidClient is returned when client authentication fails
+var ErrInvalidClient = errors.New("invalid client")
+
+// ClientAuth holds the credentials a caller presented at the token endpoint
+type ClientAuth struct {
+	ClientID     string
+	ClientSecret string
+	// ClientAssertion is the signed JWT a private_key_jwt client presented
+	ClientAssertion string
+	// DPoPJKT is the thumbprint of the key that signed the DPoP proof sent
+	// with a token request, which the issued tokens are bound to
+	DPoPJKT string
+	// Method is the authentication method the caller actually used
+	Method string
+}
+
+// AuthenticateClient verifies the presented credentials against the client's
+// configured authentication method
+func (o *OAuthService) AuthenticateClient(ctx context.Context, clientAuth *ClientAuth) (*models.Client, error) {
+	client, err := o.lookupClient(ctx, clientAuth.ClientID)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, fmt.Errorf("%w: unknown client_id", ErrInvalidClient)
+	}
+	if client.Disabled {
+		return nil, fmt.Errorf("%w: client is disabled", ErrInvalidClient)
+	}
+
+	if !client.IsConfidential() {
+		// Public clients must not be sent a secret they can't keep
+		if clientAuth.ClientSecret != "" || clientAuth.ClientAssertion != "" {
+			return nil, fmt.Errorf("%w: public client presented credentials", ErrInvalidClient)
+		}
+		return client, nil
+	}
+
+	if clientAuth.Method != client.TokenEndpointAuthMethod {
+		return nil, fmt.Errorf("%w: client must authenticate with %s", ErrInvalidClient, client.TokenEndpointAuthMethod)
+	}
+
+	if client.TokenEndpointAuthMethod == models.AuthMethodPrivateKeyJWT {
+		if err := o.verifyClientAssertion(ctx, client, clientAuth.ClientAssertion); err != nil {
+			return nil, err
+		}
+		return client, nil
+	}
+
+	if clientAuth.ClientSecret == "" || !verifyClientSecret(client.ClientSecretHashes, clientAuth.ClientSecret) {
+		return nil, fmt.Errorf("%w: client authentication failed", ErrInvalidClient)
+	}
+
+	return client, nil
+}
+
+// ValidateClientSecretHash checks that a configured secret hash is in a
+// supported format
+func ValidateClientSecretHash(hash string) error {
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		_, err := bcrypt.Cost([]byte(hash))
+		return err
+	case strings.HasPrefix(hash, "$argon2id$"):
+		_, _, _, err := parseArgon2idHash(hash)
+		return err
+	default:
+		return fmt.Errorf("unsupported secret hash format (expected bcrypt or argon2id)")
+	}
+}
+
+// verifyClientSecret checks the secret against each active hash
+func verifyClientSecret(hashes []string, secret string) bool {
+	for _, hash := range hashes {
+		if strings.HasPrefix(hash, "$argon2id$") {
+			if verifyArgon2id(hash, secret) {
+				return true
+			}
+			continue
+		}
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(secret)) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+}
+
+// parseArgon2idHash parses a PHC-formatted hash such as
+// $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>
+func parseArgon2idHash(hash string) (*argon2Params, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, nil, nil, fmt.Errorf("malformed argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, nil, nil, fmt.Errorf("unsupported argon2id version")
+	}
+
+	params := &argon2Params{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return nil, nil, nil, fmt.Errorf("malformed argon2id parameters: %w", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("malformed argon2id salt: %w", err)
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("malformed argon2id key: %w", err)
+	}
+
+	return params, salt, key, nil
+}
+
+func verifyArgon2id(hash, secret string) bool {
+	params, salt, key, err := parseArgon2idHash(hash)
+	if err != nil {
+		return false
+	}
+
+	derived := argon2.IDKey([]byte(secret), salt, params.time, params.memory, params.threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(derived, key) == 1
+}
@@ -0,0 +1,70 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/andyleap/passkey/internal/models"
+)
+
+// ErrUnauthorizedClient is returned when a client may not use a grant type
+var ErrUnauthorizedClient = errors.New("unauthorized client")
+
+// IssueClientCredentialsToken issues an access token a confidential client
+// obtains for itself (RFC 6749 section 4.4). The token has no user: its
+// subject is the client ID and its scope is limited to the client's
+// configured allowed_scopes.
+func (o *OAuthService) IssueClientCredentialsToken(ctx context.Context, scope string, clientAuth *ClientAuth) (*TokenResponse, error) {
+	client, err := o.AuthenticateClient(ctx, clientAuth)
+	if err != nil {
+		return nil, err
+	}
+	if !client.IsConfidential() {
+		return nil, fmt.Errorf("%w: client_credentials requires a confidential client", ErrUnauthorizedClient)
+	}
+
+	if err := checkDPoPRequired(client, clientAuth); err != nil {
+		return nil, err
+	}
+
+	scope, err = clientCredentialsScope(client, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	return o.issueTokens(ctx, &tokenGrant{
+		ClientID:  client.ID,
+		Scope:     scope,
+		GrantType: models.GrantTypeClientCredentials,
+		DPoPJKT:   clientAuth.DPoPJKT,
+	})
+}
+
+// clientCredentialsScope checks the requested scope against the scopes
+// configured for the client, defaulting to all of them. The default scopes of
+// clients without allowed_scopes are user scopes and don't apply, and neither
+// does openid, since there is no user to identify.
+func clientCredentialsScope(client *models.Client, scope string) (string, error) {
+	var allowed []string
+	for _, s := range client.AllowedScopes {
+		if s != ScopeOpenID {
+			allowed = append(allowed, s)
+		}
+	}
+
+	requested := strings.Fields(scope)
+	if len(requested) == 0 {
+		return strings.Join(allowed, " "), nil
+	}
+
+	for _, s := range requested {
+		if !slices.Contains(allowed, s) {
+			return "", fmt.Errorf("%w: scope %q is not allowed for this client", ErrInvalidScope, s)
+		}
+	}
+
+	return strings.Join(requested, " "), nil
+}
@@ -0,0 +1,119 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/andyleap/passkey/internal/models"
+)
+
+// ErrConsentGrantNotFound is returned when revoking access the user never
+// granted to the client
+var ErrConsentGrantNotFound = errors.New("consent grant not found")
+
+// HasConsent reports whether the user has already approved every scope in
+// scope for the client, so the consent page can be skipped
+func (o *OAuthService) HasConsent(ctx context.Context, username, clientID, scope string) (bool, error) {
+	grant, err := o.consentStorage.GetConsentGrant(ctx, username, clientID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get consent grant: %w", err)
+	}
+	if grant == nil {
+		return false, nil
+	}
+
+	for _, s := range strings.Fields(scope) {
+		if !HasScope(grant.Scope, s) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// GrantConsent remembers that the user approved scope for the client, adding
+// to any scopes approved before
+func (o *OAuthService) GrantConsent(ctx context.Context, username, clientID, scope string) error {
+	grant, err := o.consentStorage.GetConsentGrant(ctx, username, clientID)
+	if err != nil {
+		return fmt.Errorf("failed to get consent grant: %w", err)
+	}
+
+	now := time.Now()
+	if grant == nil {
+		grant = &models.ConsentGrant{
+			ClientID:  clientID,
+			CreatedAt: now,
+		}
+	}
+
+	scopes := strings.Fields(grant.Scope)
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	grant.Scope = strings.Join(scopes, " ")
+	grant.UpdatedAt = now
+
+	if err := o.consentStorage.SaveConsentGrant(ctx, username, grant); err != nil {
+		return fmt.Errorf("failed to save consent grant: %w", err)
+	}
+
+	return nil
+}
+
+// ConsentGrants returns the clients the user has granted access to, oldest
+// first
+func (o *OAuthService) ConsentGrants(ctx context.Context, username string) ([]*models.ConsentGrant, error) {
+	grants, err := o.consentStorage.GetConsentGrants(ctx, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get consent grants: %w", err)
+	}
+
+	slices.SortFunc(grants, func(a, b *models.ConsentGrant) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return grants, nil
+}
+
+// RevokeConsent forgets the user's grant for a client and revokes every token
+// the client holds for the user, so it must ask for consent again
+func (o *OAuthService) RevokeConsent(ctx context.Context, username, clientID string) error {
+	deleted, err := o.consentStorage.DeleteConsentGrant(ctx, username, clientID)
+	if err != nil {
+		return fmt.Errorf("failed to delete consent grant: %w", err)
+	}
+	if !deleted {
+		return ErrConsentGrantNotFound
+	}
+
+	now := time.Now()
+	if err := o.sessionStorage.RevokeClientTokens(ctx, username, clientID, now, now.Add(o.maxTokenLifetime())); err != nil {
+		return fmt.Errorf("failed to revoke client tokens: %w", err)
+	}
+
+	return nil
+}
+
+// ConsentToken returns the token the consent form posts back with the user's
+// decision. It is derived from the session ID, which only the user's browser
+// holds, and the authorization request, so another site can't forge a
+// decision.
+func ConsentToken(sessionID, requestID string) string {
+	sum := sha256.Sum256([]byte("consent:" + sessionID + ":" + requestID))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// VerifyConsentToken checks a token posted by the consent form against the
+// session and authorization request it was shown for
+func VerifyConsentToken(sessionID, requestID, token string) bool {
+	return subtle.ConstantTimeCompare([]byte(ConsentToken(sessionID, requestID)), []byte(token)) == 1
+}
@@ -0,0 +1,121 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestHasConsent(t *testing.T) {
+	tests := []struct {
+		name    string
+		granted []string
+		scope   string
+		want    bool
+	}{
+		{name: "no grant", scope: "read", want: false},
+		{name: "same scope", granted: []string{"read write"}, scope: "read write", want: true},
+		{name: "subset", granted: []string{"read write"}, scope: "read", want: true},
+		{name: "subset in another order", granted: []string{"read write"}, scope: "write read", want: true},
+		{name: "no scope", granted: []string{"read"}, scope: "", want: true},
+		{name: "superset", granted: []string{"read"}, scope: "read write", want: false},
+		{name: "different scope", granted: []string{"read"}, scope: "write", want: false},
+		{name: "scope name prefix", granted: []string{"read"}, scope: "re", want: false},
+		{name: "grants add up", granted: []string{"read", "write"}, scope: "read write", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, _ := newTestService(t)
+			ctx := context.Background()
+
+			for _, scope := range tt.granted {
+				if err := o.GrantConsent(ctx, "alice", "app", scope); err != nil {
+					t.Fatalf("GrantConsent() error = %v", err)
+				}
+			}
+
+			got, err := o.HasConsent(ctx, "alice", "app", tt.scope)
+			if err != nil {
+				t.Fatalf("HasConsent() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("HasConsent(%q) = %v, want %v", tt.scope, got, tt.want)
+			}
+
+			// Grants are per user and per client
+			if got, _ := o.HasConsent(ctx, "bob", "app", tt.scope); got {
+				t.Errorf("HasConsent() for another user = true")
+			}
+			if got, _ := o.HasConsent(ctx, "alice", "service", tt.scope); got {
+				t.Errorf("HasConsent() for another client = true")
+			}
+		})
+	}
+}
+
+func TestGrantConsentMergesScopes(t *testing.T) {
+	o, _ := newTestService(t)
+	ctx := context.Background()
+
+	for _, scope := range []string{"read", "write read", "read"} {
+		if err := o.GrantConsent(ctx, "alice", "app", scope); err != nil {
+			t.Fatalf("GrantConsent() error = %v", err)
+		}
+	}
+
+	grants, err := o.ConsentGrants(ctx, "alice")
+	if err != nil {
+		t.Fatalf("ConsentGrants() error = %v", err)
+	}
+	if len(grants) != 1 {
+		t.Fatalf("ConsentGrants() returned %d grants, want 1", len(grants))
+	}
+	if grants[0].Scope != "read write" {
+		t.Errorf("grant scope = %q, want %q", grants[0].Scope, "read write")
+	}
+}
+
+func TestRevokeConsent(t *testing.T) {
+	o, _ := newTestService(t)
+	ctx := context.Background()
+
+	if err := o.GrantConsent(ctx, "alice", "app", "read"); err != nil {
+		t.Fatalf("GrantConsent() error = %v", err)
+	}
+	if err := o.RevokeConsent(ctx, "alice", "app"); err != nil {
+		t.Fatalf("RevokeConsent() error = %v", err)
+	}
+	if got, _ := o.HasConsent(ctx, "alice", "app", "read"); got {
+		t.Error("HasConsent() after RevokeConsent() = true")
+	}
+
+	if err := o.RevokeConsent(ctx, "alice", "app"); !errors.Is(err, ErrConsentGrantNotFound) {
+		t.Errorf("RevokeConsent() of a revoked grant error = %v, want ErrConsentGrantNotFound", err)
+	}
+}
+
+func TestConsentToken(t *testing.T) {
+	token := ConsentToken("session", "request")
+
+	tests := []struct {
+		name      string
+		sessionID string
+		requestID string
+		token     string
+		want      bool
+	}{
+		{name: "valid", sessionID: "session", requestID: "request", token: token, want: true},
+		{name: "other session", sessionID: "other", requestID: "request", token: token, want: false},
+		{name: "other request", sessionID: "session", requestID: "other", token: token, want: false},
+		{name: "empty token", sessionID: "session", requestID: "request", token: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyConsentToken(tt.sessionID, tt.requestID, tt.token); got != tt.want {
+				t.Errorf("VerifyConsentToken() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/andyleap/passkey/internal/models"
+)
+
+// DeviceCodeGrantType is the grant_type for redeeming a device code (RFC 8628)
+const DeviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+const (
+	deviceCodeLifetime = 10 * time.Minute
+	// devicePollInterval is the minimum time between token requests for a
+	// device code
+	devicePollInterval = 5 * time.Second
+	// userCodeAlphabet has no vowels, so codes can't spell words, and no
+	// characters that are easily confused
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+	// userCodeMaxFailures is how many unknown user codes may be entered from
+	// one browser session or address in userCodeFailureWindow before further
+	// codes are refused, so codes can't be guessed (RFC 8628 section 5.1)
+	userCodeMaxFailures   = 10
+	userCodeFailureWindow = 15 * time.Minute
+)
+
+var (
+	// ErrAuthorizationPending is returned while the user hasn't yet approved
+	// a device authorization
+	ErrAuthorizationPending = errors.New("authorization pending")
+	// ErrSlowDown is returned when a device polls faster than the interval
+	ErrSlowDown = errors.New("slow down")
+	// ErrAccessDenied is returned when the user denied a device authorization
+	ErrAccessDenied = errors.New("access denied")
+	// ErrExpiredToken is returned for unknown or expired device codes
+	ErrExpiredToken = errors.New("expired token")
+	// ErrInvalidUserCode is returned for unknown or expired user codes, and
+	// for codes the user already decided on
+	ErrInvalidUserCode = errors.New("invalid or expired user code")
+	// ErrTooManyUserCodeAttempts is returned when too many unknown user codes
+	// were entered recently
+	ErrTooManyUserCodeAttempts = errors.New("too many user code attempts")
+)
+
+// DeviceAuthorizationResponse is the response of the device authorization
+// endpoint (RFC 8628 section 3.2)
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// StartDeviceAuthorization creates a device code for a client that can't
+// handle a browser redirect, and a user code the user enters at /device
+func (o *OAuthService) StartDeviceAuthorization(ctx context.Context, scope string, clientAuth *ClientAuth) (*DeviceAuthorizationResponse, error) {
+	client, err := o.AuthenticateClient(ctx, clientAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	scope, err = validateScope(client, scope)
+	if err != nil {
+		var authErr *AuthorizationError
+		if errors.As(err, &authErr) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidScope, authErr.Description)
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	auth := &models.DeviceAuthorization{
+		DeviceCode: generateRandomCode(32),
+		UserCode:   generateUserCode(),
+		ClientID:   client.ID,
+		Scope:      scope,
+		Status:     models.DeviceAuthorizationPending,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(deviceCodeLifetime),
+	}
+
+	if err := o.sessionStorage.SaveDeviceAuthorization(ctx, auth); err != nil {
+		return nil, fmt.Errorf("failed to save device authorization: %w", err)
+	}
+
+	userCode := FormatUserCode(auth.UserCode)
+	verificationURI := o.options.Issuer + "/device"
+
+	return &DeviceAuthorizationResponse{
+		DeviceCode:              auth.DeviceCode,
+		UserCode:                userCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + url.QueryEscape(userCode),
+		ExpiresIn:               int(deviceCodeLifetime.Seconds()),
+		Interval:                int(devicePollInterval.Seconds()),
+	}, nil
+}
+
+// GetPendingDeviceAuthorization looks up a device authorization the user
+// hasn't decided on yet by the user code they typed
+func (o *OAuthService) GetPendingDeviceAuthorization(ctx context.Context, userCode string) (*models.DeviceAuthorization, error) {
+	auth, err := o.sessionStorage.GetDeviceAuthorizationByUserCode(ctx, NormalizeUserCode(userCode))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device authorization: %w", err)
+	}
+	if auth == nil || time.Now().After(auth.ExpiresAt) || auth.Status != models.DeviceAuthorizationPending {
+		return nil, ErrInvalidUserCode
+	}
+
+	return auth, nil
+}
+
+// EnterUserCode looks up a pending device authorization by a user code the
+// user typed. Unknown codes count as failures against each of keys, which
+// identify who entered the code; once any key reaches userCodeMaxFailures,
+// every code is refused with ErrTooManyUserCodeAttempts until its window ends.
+func (o *OAuthService) EnterUserCode(ctx context.Context, userCode string, keys []string) (*models.DeviceAuthorization, error) {
+	for _, key := range keys {
+		failures, err := o.sessionStorage.UserCodeFailures(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check user code failures: %w", err)
+		}
+		if failures >= userCodeMaxFailures {
+			return nil, ErrTooManyUserCodeAttempts
+		}
+	}
+
+	auth, err := o.GetPendingDeviceAuthorization(ctx, userCode)
+	if !errors.Is(err, ErrInvalidUserCode) {
+		return auth, err
+	}
+
+	for _, key := range keys {
+		if _, err := o.sessionStorage.RecordUserCodeFailure(ctx, key, userCodeFailureWindow); err != nil {
+			return nil, fmt.Errorf("failed to record user code failure: %w", err)
+		}
+	}
+
+	return nil, err
+}
+
+// ApproveDeviceAuthorization lets the device waiting on userCode redeem its
+// device code for tokens for the session's user
+func (o *OAuthService) ApproveDeviceAuthorization(ctx context.Context, userCode string, session *models.Session) error {
+	auth, err := o.GetPendingDeviceAuthorization(ctx, userCode)
+	if err != nil {
+		return err
+	}
+
+	auth.Status = models.DeviceAuthorizationApproved
+	auth.Username = session.Username
+	auth.UserID = session.UserID
+	auth.SessionID = session.ID
+	auth.AuthTime = session.AuthenticatedAt()
+
+	if err := o.sessionStorage.SaveDeviceAuthorization(ctx, auth); err != nil {
+		return fmt.Errorf("failed to save device authorization: %w", err)
+	}
+
+	return nil
+}
+
+// DenyDeviceAuthorization reports access_denied to the device waiting on
+// userCode
+func (o *OAuthService) DenyDeviceAuthorization(ctx context.Context, userCode string) error {
+	auth, err := o.GetPendingDeviceAuthorization(ctx, userCode)
+	if err != nil {
+		return err
+	}
+
+	auth.Status = models.DeviceAuthorizationDenied
+
+	if err := o.sessionStorage.SaveDeviceAuthorization(ctx, auth); err != nil {
+		return fmt.Errorf("failed to save device authorization: %w", err)
+	}
+
+	return nil
+}
+
+// ExchangeDeviceCode handles a device's token request. Until the user decides
+// it fails with ErrAuthorizationPending, or ErrSlowDown if the device polls
+// faster than the interval it was given.
+func (o *OAuthService) ExchangeDeviceCode(ctx context.Context, deviceCode string, clientAuth *ClientAuth) (*TokenResponse, error) {
+	client, err := o.AuthenticateClient(ctx, clientAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err := o.sessionStorage.GetDeviceAuthorization(ctx, deviceCode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device authorization: %w", err)
+	}
+	if auth == nil || time.Now().After(auth.ExpiresAt) {
+		return nil, ErrExpiredToken
+	}
+	if auth.ClientID != client.ID {
+		return nil, fmt.Errorf("%w: device code was issued to another client", ErrInvalidGrant)
+	}
+	if err := checkDPoPRequired(client, clientAuth); err != nil {
+		return nil, err
+	}
+
+	if auth.Status == models.DeviceAuthorizationPending {
+		tooFast, err := o.sessionStorage.RecordDevicePoll(ctx, deviceCode, devicePollInterval)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record device poll: %w", err)
+		}
+		if tooFast {
+			return nil, ErrSlowDown
+		}
+		return nil, ErrAuthorizationPending
+	}
+
+	// Approved or denied, the device code can only be redeemed once
+	auth, err = o.sessionStorage.ConsumeDeviceAuthorization(ctx, deviceCode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume device authorization: %w", err)
+	}
+	if auth == nil {
+		return nil, ErrExpiredToken
+	}
+	if auth.Status != models.DeviceAuthorizationApproved {
+		return nil, ErrAccessDenied
+	}
+
+	return o.issueTokens(ctx, &tokenGrant{
+		FamilyID:  generateRandomCode(16),
+		ClientID:  auth.ClientID,
+		Username:  auth.Username,
+		UserID:    auth.UserID,
+		Scope:     auth.Scope,
+		AuthTime:  auth.AuthTime,
+		SessionID: auth.SessionID,
+		DPoPJKT:   clientAuth.DPoPJKT,
+	})
+}
+
+// NormalizeUserCode strips the separator, whitespace and case from a user
+// code as typed by the user
+func NormalizeUserCode(userCode string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(userCode) {
+		if strings.ContainsRune(userCodeAlphabet, r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// FormatUserCode displays a user code as two groups, e.g. "BDFH-JKLM"
+func FormatUserCode(userCode string) string {
+	if len(userCode) != userCodeLength {
+		return userCode
+	}
+	return userCode[:userCodeLength/2] + "-" + userCode[userCodeLength/2:]
+}
+
+func generateUserCode() string {
+	code := make([]byte, userCodeLength)
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+	for i := range code {
+		n, _ := rand.Int(rand.Reader, max)
+		code[i] = userCodeAlphabet[n.Int64()]
+	}
+	return string(code)
+}
@@ -0,0 +1,58 @@
+package oauth
+
+import (
+	"github.com/andyleap/passkey/internal/models"
+)
+
+// DiscoveryDocument returns the OpenID Provider metadata served at
+// /.well-known/openid-configuration
+func (o *OAuthService) DiscoveryDocument() map[string]any {
+	issuer := o.options.Issuer
+
+	challengeMethods := []string{CodeChallengeMethodS256}
+	if o.options.AllowPlainPKCE {
+		challengeMethods = append(challengeMethods, CodeChallengeMethodPlain)
+	}
+
+	document := map[string]any{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/authorize",
+		"token_endpoint":                        issuer + "/oauth/token",
+		"userinfo_endpoint":                     issuer + "/oauth/userinfo",
+		"introspection_endpoint":                issuer + "/oauth/introspect",
+		"revocation_endpoint":                   issuer + "/oauth/revoke",
+		"device_authorization_endpoint":         issuer + "/oauth/device_authorization",
+		"pushed_authorization_request_endpoint": issuer + "/oauth/par",
+		"end_session_endpoint":                  issuer + "/oauth/logout",
+		"jwks_uri":                              issuer + "/.well-known/jwks.json",
+		"response_types_supported":              []string{"code"},
+		"response_modes_supported":              []string{models.ResponseModeQuery, models.ResponseModeFragment, models.ResponseModeFormPost},
+		"grant_types_supported":                 []string{"authorization_code", "refresh_token", models.GrantTypeClientCredentials, DeviceCodeGrantType},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{o.keyManager.Algorithm()},
+		"scopes_supported":                      []string{ScopeOpenID, ScopeProfile},
+		"claims_supported":                      []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "amr", "sid", "preferred_username", "name"},
+		"token_endpoint_auth_methods_supported": []string{
+			models.AuthMethodClientSecretBasic,
+			models.AuthMethodClientSecretPost,
+			models.AuthMethodPrivateKeyJWT,
+			models.AuthMethodNone,
+		},
+		"code_challenge_methods_supported":     challengeMethods,
+		"backchannel_logout_supported":         true,
+		"backchannel_logout_session_supported": true,
+		// Individual clients can still be configured with require_par
+		"require_pushed_authorization_requests": false,
+		// Algorithms accepted for private_key_jwt client assertions
+		"token_endpoint_auth_signing_alg_values_supported": clientAssertionAlgorithms,
+		// DPoP proofs are accepted at the token endpoint and with access
+		// tokens (RFC 9449 section 5.1)
+		"dpop_signing_alg_values_supported": DPoPSigningAlgorithms(),
+	}
+
+	if o.options.RegistrationToken != "" {
+		document["registration_endpoint"] = issuer + "/oauth/register"
+	}
+
+	return document
+}
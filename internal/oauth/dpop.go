@@ -0,0 +1,211 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andyleap/passkey/internal/keys"
+	"github.com/andyleap/passkey/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DPoPTokenType is the token_type of access tokens bound to a DPoP key, and
+// the Authorization scheme they are presented with (RFC 9449 section 5)
+const DPoPTokenType = "DPoP"
+
+// dpopProofType is the JWT "typ" header of DPoP proofs
+const dpopProofType = "dpop+jwt"
+
+const (
+	// dpopProofLifetime is how long after its iat a proof is accepted, and so
+	// how long its jti has to be remembered
+	dpopProofLifetime = 5 * time.Minute
+	// dpopLeeway allows for clocks running ahead of the server's
+	dpopLeeway = 30 * time.Second
+	// dpopNonceLifetime is how long a nonce handed out to clients is accepted
+	dpopNonceLifetime = 10 * time.Minute
+	// dpopNonceRotation is how often a new nonce is handed out. Older nonces
+	// stay valid for the rest of their lifetime so clients aren't rejected
+	// just after a rotation.
+	dpopNonceRotation = 2 * time.Minute
+)
+
+var (
+	// ErrInvalidDPoPProof is returned when a DPoP proof is missing where one
+	// is required, malformed, or doesn't match the request or token
+	ErrInvalidDPoPProof = errors.New("invalid DPoP proof")
+	// ErrUseDPoPNonce is returned when a DPoP proof lacks the current server
+	// nonce; the client retries with the nonce from the DPoP-Nonce header
+	ErrUseDPoPNonce = errors.New("DPoP nonce required")
+)
+
+// DPoPSigningAlgorithms returns the JWS algorithms accepted for DPoP proofs,
+// the same as for client assertions
+func DPoPSigningAlgorithms() []string {
+	return slices.Clone(clientAssertionAlgorithms)
+}
+
+// DPoPNonce returns the nonce clients must include in their DPoP proofs
+// (RFC 9449 section 8)
+func (o *OAuthService) DPoPNonce(ctx context.Context) (string, error) {
+	n := o.dpopNonces
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.nonce != "" && time.Since(n.issuedAt) < dpopNonceRotation {
+		return n.nonce, nil
+	}
+
+	now := time.Now()
+	nonce := generateRandomCode(16)
+	if err := o.sessionStorage.SaveDPoPNonce(ctx, nonce, now.Add(dpopNonceLifetime)); err != nil {
+		return "", fmt.Errorf("failed to save DPoP nonce: %w", err)
+	}
+	n.nonce, n.issuedAt = nonce, now
+
+	return nonce, nil
+}
+
+// VerifyDPoPProof checks a DPoP proof sent with a request for path (RFC 9449
+// section 4.3) and returns the thumbprint of the key that signed it. When the
+// request carries an access token, the proof must be bound to it by "ath".
+func (o *OAuthService) VerifyDPoPProof(ctx context.Context, method, path, proof, accessToken string) (string, error) {
+	var jwk *keys.JWK
+	parsed, err := jwt.Parse(proof, func(token *jwt.Token) (any, error) {
+		if typ, _ := token.Header["typ"].(string); typ != dpopProofType {
+			return nil, fmt.Errorf("typ must be %s", dpopProofType)
+		}
+
+		var err error
+		jwk, err = dpopProofKey(token.Header["jwk"])
+		if err != nil {
+			return nil, err
+		}
+		return jwk.PublicKey()
+	}, jwt.WithValidMethods(clientAssertionAlgorithms))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidDPoPProof, err)
+	}
+
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", fmt.Errorf("%w: unexpected claims", ErrInvalidDPoPProof)
+	}
+
+	if htm, _ := claims["htm"].(string); htm != method {
+		return "", fmt.Errorf("%w: htm doesn't match the request method", ErrInvalidDPoPProof)
+	}
+	if htu, _ := claims["htu"].(string); !o.dpopTargetMatches(htu, path) {
+		return "", fmt.Errorf("%w: htu doesn't match the request URI", ErrInvalidDPoPProof)
+	}
+
+	issuedAt, err := claims.GetIssuedAt()
+	if err != nil || issuedAt == nil {
+		return "", fmt.Errorf("%w: iat is required", ErrInvalidDPoPProof)
+	}
+	if age := time.Since(issuedAt.Time); age > dpopProofLifetime || age < -dpopLeeway {
+		return "", fmt.Errorf("%w: proof was issued too long ago or in the future", ErrInvalidDPoPProof)
+	}
+
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return "", fmt.Errorf("%w: jti is required", ErrInvalidDPoPProof)
+	}
+
+	if accessToken != "" {
+		hash := sha256.Sum256([]byte(accessToken))
+		if ath, _ := claims["ath"].(string); ath != base64.RawURLEncoding.EncodeToString(hash[:]) {
+			return "", fmt.Errorf("%w: ath doesn't match the access token", ErrInvalidDPoPProof)
+		}
+	}
+
+	nonce, _ := claims["nonce"].(string)
+	if nonce == "" {
+		return "", ErrUseDPoPNonce
+	}
+	valid, err := o.sessionStorage.DPoPNonceValid(ctx, nonce)
+	if err != nil {
+		return "", fmt.Errorf("failed to check DPoP nonce: %w", err)
+	}
+	if !valid {
+		return "", fmt.Errorf("%w: nonce is invalid or expired", ErrUseDPoPNonce)
+	}
+
+	// Remember the jti for as long as the proof would be accepted
+	jkt := jwk.Thumbprint()
+	replayed, err := o.sessionStorage.MarkDPoPProofUsed(ctx, jkt, jti, issuedAt.Add(dpopProofLifetime+dpopLeeway))
+	if err != nil {
+		return "", fmt.Errorf("failed to record DPoP proof: %w", err)
+	}
+	if replayed {
+		return "", fmt.Errorf("%w: proof has already been used", ErrInvalidDPoPProof)
+	}
+
+	return jkt, nil
+}
+
+// dpopProofKey decodes the public key a proof carries in its "jwk" header
+func dpopProofKey(header any) (*keys.JWK, error) {
+	members, ok := header.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("jwk header is required")
+	}
+	if _, private := members["d"]; private {
+		return nil, fmt.Errorf("jwk must not contain a private key")
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return nil, fmt.Errorf("malformed jwk header")
+	}
+	var jwk keys.JWK
+	if err := json.Unmarshal(data, &jwk); err != nil {
+		return nil, fmt.Errorf("malformed jwk header")
+	}
+
+	return &jwk, nil
+}
+
+// dpopTargetMatches compares a proof's htu with the URI of the request it was
+// sent with, ignoring any query and fragment
+func (o *OAuthService) dpopTargetMatches(htu, path string) bool {
+	target, err := url.Parse(htu)
+	if err != nil {
+		return false
+	}
+	issuer, err := url.Parse(o.options.Issuer)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(target.Scheme, issuer.Scheme) &&
+		strings.EqualFold(target.Host, issuer.Host) &&
+		target.Path == strings.TrimSuffix(issuer.Path, "/")+path
+}
+
+// checkDPoPRequired rejects token requests without a DPoP proof from clients
+// configured with require_dpop
+func checkDPoPRequired(client *models.Client, clientAuth *ClientAuth) error {
+	if client.RequireDPoP && clientAuth.DPoPJKT == "" {
+		return fmt.Errorf("%w: this client must send a DPoP proof", ErrInvalidDPoPProof)
+	}
+	return nil
+}
+
+// dpopNonceSource holds the DPoP nonce currently handed out, replaced every
+// dpopNonceRotation. Nonces are recorded in session storage so that every
+// instance of the service accepts them.
+type dpopNonceSource struct {
+	mu       sync.Mutex
+	nonce    string
+	issuedAt time.Time
+}
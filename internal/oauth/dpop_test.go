@@ -0,0 +1,301 @@
+package oauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/andyleap/passkey/internal/keys"
+	"github.com/andyleap/passkey/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// dpopKey is a client's DPoP key pair
+type dpopKey struct {
+	private *ecdsa.PrivateKey
+	jwk     keys.JWK
+}
+
+func newDPoPKey(t *testing.T) *dpopKey {
+	t.Helper()
+
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &dpopKey{
+		private: private,
+		jwk: keys.JWK{
+			Kty: "EC",
+			Crv: "P-256",
+			X:   base64.RawURLEncoding.EncodeToString(private.X.FillBytes(make([]byte, 32))),
+			Y:   base64.RawURLEncoding.EncodeToString(private.Y.FillBytes(make([]byte, 32))),
+		},
+	}
+}
+
+// header returns the key as a "jwk" header, with the private key too if
+// withPrivate is set
+func (k *dpopKey) header(withPrivate bool) map[string]any {
+	header := map[string]any{"kty": k.jwk.Kty, "crv": k.jwk.Crv, "x": k.jwk.X, "y": k.jwk.Y}
+	if withPrivate {
+		header["d"] = base64.RawURLEncoding.EncodeToString(k.private.D.FillBytes(make([]byte, 32)))
+	}
+	return header
+}
+
+func (k *dpopKey) sign(t *testing.T, header map[string]any, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	for name, value := range header {
+		token.Header[name] = value
+	}
+	proof, err := token.SignedString(k.private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proof
+}
+
+// newDPoPService returns a test service with the issuer set and the nonce it
+// currently hands out
+func newDPoPService(t *testing.T) (*OAuthService, string) {
+	t.Helper()
+
+	o, _ := newTestService(t)
+	o.options.Issuer = testIssuer
+
+	nonce, err := o.DPoPNonce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o, nonce
+}
+
+func dpopClaims(jti, nonce string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"htm":   "POST",
+		"htu":   testIssuer + "/oauth/token",
+		"iat":   time.Now().Unix(),
+		"jti":   jti,
+		"nonce": nonce,
+	}
+}
+
+func accessTokenHash(accessToken string) string {
+	hash := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+func TestVerifyDPoPProof(t *testing.T) {
+	key := newDPoPKey(t)
+
+	tests := []struct {
+		name        string
+		header      func(map[string]any)
+		claims      func(jwt.MapClaims)
+		accessToken string
+		wantErr     error
+	}{
+		{name: "valid"},
+		{name: "htu with query", claims: func(c jwt.MapClaims) { c["htu"] = testIssuer + "/oauth/token?x=1" }},
+		{name: "iat within leeway", claims: func(c jwt.MapClaims) { c["iat"] = time.Now().Add(10 * time.Second).Unix() }},
+		{name: "wrong typ", header: func(h map[string]any) { h["typ"] = "JWT" }, wantErr: ErrInvalidDPoPProof},
+		{name: "missing typ", header: func(h map[string]any) { delete(h, "typ") }, wantErr: ErrInvalidDPoPProof},
+		{name: "missing jwk", header: func(h map[string]any) { delete(h, "jwk") }, wantErr: ErrInvalidDPoPProof},
+		{name: "private key in jwk", header: func(h map[string]any) { h["jwk"] = key.header(true) }, wantErr: ErrInvalidDPoPProof},
+		{name: "htm mismatch", claims: func(c jwt.MapClaims) { c["htm"] = "GET" }, wantErr: ErrInvalidDPoPProof},
+		{name: "htu path mismatch", claims: func(c jwt.MapClaims) { c["htu"] = testIssuer + "/oauth/revoke" }, wantErr: ErrInvalidDPoPProof},
+		{name: "htu host mismatch", claims: func(c jwt.MapClaims) { c["htu"] = "https://other.example.com/oauth/token" }, wantErr: ErrInvalidDPoPProof},
+		{name: "missing iat", claims: func(c jwt.MapClaims) { delete(c, "iat") }, wantErr: ErrInvalidDPoPProof},
+		{name: "iat too old", claims: func(c jwt.MapClaims) { c["iat"] = time.Now().Add(-dpopProofLifetime - time.Minute).Unix() }, wantErr: ErrInvalidDPoPProof},
+		{name: "iat in the future", claims: func(c jwt.MapClaims) { c["iat"] = time.Now().Add(time.Minute).Unix() }, wantErr: ErrInvalidDPoPProof},
+		{name: "missing jti", claims: func(c jwt.MapClaims) { delete(c, "jti") }, wantErr: ErrInvalidDPoPProof},
+		{name: "missing nonce", claims: func(c jwt.MapClaims) { delete(c, "nonce") }, wantErr: ErrUseDPoPNonce},
+		{name: "unknown nonce", claims: func(c jwt.MapClaims) { c["nonce"] = "unknown" }, wantErr: ErrUseDPoPNonce},
+		{
+			name:        "ath",
+			claims:      func(c jwt.MapClaims) { c["ath"] = accessTokenHash("access-token") },
+			accessToken: "access-token",
+		},
+		{
+			name:        "ath for another token",
+			claims:      func(c jwt.MapClaims) { c["ath"] = accessTokenHash("other-token") },
+			accessToken: "access-token",
+			wantErr:     ErrInvalidDPoPProof,
+		},
+		{name: "missing ath", accessToken: "access-token", wantErr: ErrInvalidDPoPProof},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, nonce := newDPoPService(t)
+
+			header := map[string]any{"typ": "dpop+jwt", "jwk": key.header(false)}
+			if tt.header != nil {
+				tt.header(header)
+			}
+			claims := dpopClaims(tt.name, nonce)
+			if tt.claims != nil {
+				tt.claims(claims)
+			}
+
+			jkt, err := o.VerifyDPoPProof(context.Background(), "POST", "/oauth/token", key.sign(t, header, claims), tt.accessToken)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("VerifyDPoPProof() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyDPoPProof() error = %v", err)
+			}
+			if jkt != key.jwk.Thumbprint() {
+				t.Errorf("VerifyDPoPProof() = %q, want the key's thumbprint %q", jkt, key.jwk.Thumbprint())
+			}
+		})
+	}
+}
+
+func TestVerifyDPoPProofReplay(t *testing.T) {
+	key := newDPoPKey(t)
+	o, nonce := newDPoPService(t)
+	ctx := context.Background()
+
+	header := map[string]any{"typ": "dpop+jwt", "jwk": key.header(false)}
+	proof := key.sign(t, header, dpopClaims("replayed", nonce))
+
+	if _, err := o.VerifyDPoPProof(ctx, "POST", "/oauth/token", proof, ""); err != nil {
+		t.Fatalf("VerifyDPoPProof() error = %v", err)
+	}
+	if _, err := o.VerifyDPoPProof(ctx, "POST", "/oauth/token", proof, ""); !errors.Is(err, ErrInvalidDPoPProof) {
+		t.Errorf("VerifyDPoPProof() with a replayed proof error = %v, want ErrInvalidDPoPProof", err)
+	}
+
+	// A new jti is accepted
+	if _, err := o.VerifyDPoPProof(ctx, "POST", "/oauth/token", key.sign(t, header, dpopClaims("fresh", nonce)), ""); err != nil {
+		t.Errorf("VerifyDPoPProof() error = %v", err)
+	}
+}
+
+func TestDPoPNonce(t *testing.T) {
+	key := newDPoPKey(t)
+	o, nonce := newDPoPService(t)
+	ctx := context.Background()
+	header := map[string]any{"typ": "dpop+jwt", "jwk": key.header(false)}
+
+	// A proof without a nonce is challenged to use the current one
+	_, err := o.VerifyDPoPProof(ctx, "POST", "/oauth/token", key.sign(t, header, dpopClaims("no-nonce", "")), "")
+	if !errors.Is(err, ErrUseDPoPNonce) {
+		t.Fatalf("VerifyDPoPProof() without a nonce error = %v, want ErrUseDPoPNonce", err)
+	}
+
+	again, err := o.DPoPNonce(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != nonce {
+		t.Errorf("DPoPNonce() = %q before rotation, want %q", again, nonce)
+	}
+
+	o.dpopNonces.issuedAt = time.Now().Add(-dpopNonceRotation)
+	rotated, err := o.DPoPNonce(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated == nonce {
+		t.Fatal("DPoPNonce() wasn't rotated")
+	}
+
+	// Both nonces are accepted until the old one expires
+	for i, n := range []string{nonce, rotated} {
+		if _, err := o.VerifyDPoPProof(ctx, "POST", "/oauth/token", key.sign(t, header, dpopClaims(n, n)), ""); err != nil {
+			t.Errorf("VerifyDPoPProof() with nonce %d error = %v", i, err)
+		}
+	}
+}
+
+func TestRefreshTokensDPoPBinding(t *testing.T) {
+	o, _ := newTestService(t)
+	ctx := context.Background()
+	jkt := newDPoPKey(t).jwk.Thumbprint()
+	otherJKT := newDPoPKey(t).jwk.Thumbprint()
+
+	issue := func(clientID string) *TokenResponse {
+		t.Helper()
+		tokens, err := o.IssueTokens(ctx, &models.AuthorizationCode{
+			ClientID: clientID,
+			Username: "alice",
+			UserID:   []byte("alice-id"),
+			Scope:    "read",
+			AuthTime: time.Now(),
+		}, jkt)
+		if err != nil {
+			t.Fatalf("IssueTokens() error = %v", err)
+		}
+		if tokens.TokenType != DPoPTokenType {
+			t.Fatalf("IssueTokens() token type = %q, want %q", tokens.TokenType, DPoPTokenType)
+		}
+		return tokens
+	}
+
+	// A public client's refresh token is bound to its DPoP key
+	public := issue("app")
+	for _, presented := range []string{"", otherJKT} {
+		clientAuth := &ClientAuth{ClientID: "app", Method: "none", DPoPJKT: presented}
+		if _, err := o.RefreshTokens(ctx, public.RefreshToken, "", clientAuth); !errors.Is(err, ErrInvalidGrant) {
+			t.Errorf("RefreshTokens() with DPoP key %q error = %v, want ErrInvalidGrant", presented, err)
+		}
+	}
+	refreshed, err := o.RefreshTokens(ctx, public.RefreshToken, "", &ClientAuth{ClientID: "app", Method: "none", DPoPJKT: jkt})
+	if err != nil {
+		t.Fatalf("RefreshTokens() with the bound key error = %v", err)
+	}
+	if refreshed.TokenType != DPoPTokenType {
+		t.Errorf("RefreshTokens() token type = %q, want %q", refreshed.TokenType, DPoPTokenType)
+	}
+
+	// A confidential client's refresh token is bound to its credentials instead
+	confidential := issue("service")
+	clientAuth := &ClientAuth{ClientID: "service", ClientSecret: "secret", Method: "client_secret_basic"}
+	refreshed, err = o.RefreshTokens(ctx, confidential.RefreshToken, "", clientAuth)
+	if err != nil {
+		t.Fatalf("RefreshTokens() for a confidential client error = %v", err)
+	}
+	if refreshed.TokenType != "Bearer" {
+		t.Errorf("RefreshTokens() without a proof token type = %q, want Bearer", refreshed.TokenType)
+	}
+}
+
+func TestCheckDPoPRequired(t *testing.T) {
+	tests := []struct {
+		name        string
+		requireDPoP bool
+		dpopJKT     string
+		wantErr     bool
+	}{
+		{name: "not required, no proof"},
+		{name: "not required, proof", dpopJKT: "jkt"},
+		{name: "required, proof", requireDPoP: true, dpopJKT: "jkt"},
+		{name: "required, no proof", requireDPoP: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkDPoPRequired(&models.Client{RequireDPoP: tt.requireDPoP}, &ClientAuth{DPoPJKT: tt.dpopJKT})
+			if tt.wantErr && !errors.Is(err, ErrInvalidDPoPProof) {
+				t.Errorf("checkDPoPRequired() error = %v, want ErrInvalidDPoPProof", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("checkDPoPRequired() error = %v", err)
+			}
+		})
+	}
+}
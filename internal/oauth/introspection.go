@@ -0,0 +1,286 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/andyleap/passkey/internal/models"
+)
+
+// Token type hints accepted by introspection and revocation (RFC 7009 section
+// 2.1), plus a hint for the service's own session IDs
+const (
+	TokenTypeHintAccessToken  = "access_token"
+	TokenTypeHintRefreshToken = "refresh_token"
+	TokenTypeHintSession      = "session"
+)
+
+// Subject types reported by introspection, telling user tokens apart from
+// tokens a client obtained for itself
+const (
+	SubjectTypeUser   = "user"
+	SubjectTypeClient = "client"
+)
+
+// Introspection is the RFC 7662 introspection response. Only Active is set
+// for tokens that are unknown, expired or revoked.
+type Introspection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Iss       string `json:"iss,omitempty"`
+	// SubjectType is "user", or "client" for client credentials tokens
+	SubjectType string `json:"subject_type,omitempty"`
+	// GrantType is set to "client_credentials" for client credentials tokens
+	GrantType string `json:"grant_type,omitempty"`
+	// Cnf carries the thumbprint of the DPoP key a token or session is bound
+	// to, which the resource server checks the request's proof against
+	// (RFC 9449 section 6.2)
+	Cnf *Confirmation `json:"cnf,omitempty"`
+}
+
+// Confirmation is the "cnf" claim of a token bound to a key
+type Confirmation struct {
+	JKT string `json:"jkt"`
+}
+
+// dpopConfirmation returns the "cnf" claim for a DPoP key thumbprint, if any
+func dpopConfirmation(jkt string) *Confirmation {
+	if jkt == "" {
+		return nil
+	}
+	return &Confirmation{JKT: jkt}
+}
+
+// IntrospectToken describes an access token, refresh token or session ID.
+// Only confidential clients, such as API gateways, may introspect.
+func (o *OAuthService) IntrospectToken(ctx context.Context, token, hint string, clientAuth *ClientAuth) (*Introspection, error) {
+	client, err := o.AuthenticateClient(ctx, clientAuth)
+	if err != nil {
+		return nil, err
+	}
+	if !client.IsConfidential() {
+		return nil, fmt.Errorf("%w: introspection requires a confidential client", ErrInvalidClient)
+	}
+
+	for _, lookup := range tokenLookupOrder(hint) {
+		var result *Introspection
+		var err error
+		switch lookup {
+		case TokenTypeHintAccessToken:
+			result, err = o.introspectAccessToken(ctx, token)
+		case TokenTypeHintRefreshToken:
+			result, err = o.introspectRefreshToken(ctx, token)
+		case TokenTypeHintSession:
+			result, err = o.introspectSession(ctx, token)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if result != nil {
+			result.Active = true
+			result.Iss = o.options.Issuer
+			return result, nil
+		}
+	}
+
+	return &Introspection{Active: false}, nil
+}
+
+func (o *OAuthService) introspectAccessToken(ctx context.Context, token string) (*Introspection, error) {
+	accessToken, err := o.ValidateAccessToken(ctx, token)
+	if err == ErrInvalidToken {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	subjectType := SubjectTypeUser
+	if accessToken.IsClientToken() {
+		subjectType = SubjectTypeClient
+	}
+
+	tokenType := "Bearer"
+	if accessToken.DPoPJKT != "" {
+		tokenType = DPoPTokenType
+	}
+
+	return &Introspection{
+		Scope:       accessToken.Scope,
+		ClientID:    accessToken.ClientID,
+		Username:    accessToken.Username,
+		TokenType:   tokenType,
+		Exp:         accessToken.ExpiresAt.Unix(),
+		Iat:         accessToken.CreatedAt.Unix(),
+		Sub:         AccessTokenSubject(accessToken),
+		SubjectType: subjectType,
+		GrantType:   accessToken.GrantType,
+		Cnf:         dpopConfirmation(accessToken.DPoPJKT),
+	}, nil
+}
+
+func (o *OAuthService) introspectRefreshToken(ctx context.Context, token string) (*Introspection, error) {
+	refreshToken, err := o.liveRefreshToken(ctx, token)
+	if err != nil || refreshToken == nil || refreshToken.Used {
+		return nil, err
+	}
+
+	return &Introspection{
+		Scope:       refreshToken.Scope,
+		ClientID:    refreshToken.ClientID,
+		Username:    refreshToken.Username,
+		Exp:         refreshToken.ExpiresAt.Unix(),
+		Iat:         refreshToken.CreatedAt.Unix(),
+		Sub:         Subject(refreshToken.UserID),
+		SubjectType: SubjectTypeUser,
+		Cnf:         dpopConfirmation(refreshToken.DPoPJKT),
+	}, nil
+}
+
+func (o *OAuthService) introspectSession(ctx context.Context, sessionID string) (*Introspection, error) {
+	session, err := o.sessionStorage.GetSession(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	if session == nil || time.Now().After(session.ExpiresAt) {
+		return nil, nil
+	}
+
+	return &Introspection{
+		Username:    session.Username,
+		Exp:         session.ExpiresAt.Unix(),
+		Iat:         session.CreatedAt.Unix(),
+		Sub:         Subject(session.UserID),
+		SubjectType: SubjectTypeUser,
+		Cnf:         dpopConfirmation(session.DPoPJKT),
+	}, nil
+}
+
+// RevokeToken revokes an access token, refresh token or session ID (RFC 7009).
+// Revoking a refresh token also revokes every access token issued from the
+// same authorization. Unknown tokens and tokens issued to other clients are
+// ignored, as the spec requires the same response for both. A session is only
+// ended for a confidential client that was issued tokens during it.
+func (o *OAuthService) RevokeToken(ctx context.Context, token, hint string, clientAuth *ClientAuth) error {
+	client, err := o.AuthenticateClient(ctx, clientAuth)
+	if err != nil {
+		return err
+	}
+
+	for _, lookup := range tokenLookupOrder(hint) {
+		var found bool
+		var err error
+		switch lookup {
+		case TokenTypeHintAccessToken:
+			found, err = o.revokeAccessToken(ctx, token, client)
+		case TokenTypeHintRefreshToken:
+			found, err = o.revokeRefreshToken(ctx, token, client)
+		case TokenTypeHintSession:
+			found, err = o.revokeSession(ctx, token, client)
+		}
+		if err != nil || found {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (o *OAuthService) revokeAccessToken(ctx context.Context, token string, client *models.Client) (bool, error) {
+	accessToken, err := o.ValidateAccessToken(ctx, token)
+	if err == ErrInvalidToken {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if accessToken.ClientID != client.ID {
+		return true, nil
+	}
+
+	if err := o.sessionStorage.DeleteAccessToken(ctx, accessToken.Token); err != nil {
+		return false, fmt.Errorf("failed to delete access token: %w", err)
+	}
+
+	return true, nil
+}
+
+func (o *OAuthService) revokeRefreshToken(ctx context.Context, token string, client *models.Client) (bool, error) {
+	refreshToken, err := o.liveRefreshToken(ctx, token)
+	if err != nil || refreshToken == nil {
+		return false, err
+	}
+	if refreshToken.ClientID != client.ID {
+		return true, nil
+	}
+
+	if err := o.RevokeTokenFamily(ctx, refreshToken.FamilyID); err != nil {
+		return false, err
+	}
+	if err := o.sessionStorage.DeleteRefreshToken(ctx, token); err != nil {
+		return false, fmt.Errorf("failed to delete refresh token: %w", err)
+	}
+
+	return true, nil
+}
+
+func (o *OAuthService) revokeSession(ctx context.Context, sessionID string, client *models.Client) (bool, error) {
+	session, err := o.sessionStorage.GetSession(ctx, sessionID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get session: %w", err)
+	}
+	if session == nil {
+		return false, nil
+	}
+	if !client.IsConfidential() || !slices.Contains(session.ClientIDs, client.ID) {
+		return true, nil
+	}
+
+	if err := o.EndSession(ctx, session); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// liveRefreshToken returns a refresh token that has neither expired nor been
+// revoked, or nil
+func (o *OAuthService) liveRefreshToken(ctx context.Context, token string) (*models.RefreshToken, error) {
+	refreshToken, err := o.sessionStorage.GetRefreshToken(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+	if refreshToken == nil || time.Now().After(refreshToken.ExpiresAt) {
+		return nil, nil
+	}
+
+	revoked, err := o.tokenRevoked(ctx, refreshToken.FamilyID, refreshToken.Username, refreshToken.ClientID, refreshToken.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, nil
+	}
+
+	return refreshToken, nil
+}
+
+// tokenLookupOrder tries the hinted token type first; the hint is only an
+// optimisation, so every type is still searched
+func tokenLookupOrder(hint string) []string {
+	order := []string{TokenTypeHintAccessToken, TokenTypeHintRefreshToken, TokenTypeHintSession}
+	for i, t := range order {
+		if t == hint {
+			return append([]string{t}, append(order[:i:i], order[i+1:]...)...)
+		}
+	}
+	return order
+}
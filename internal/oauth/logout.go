@@ -0,0 +1,139 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+
+	"github.com/andyleap/passkey/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrInvalidLogoutRequest is returned for end session requests that can't be
+// honoured, such as one with an unregistered post_logout_redirect_uri
+var ErrInvalidLogoutRequest = errors.New("invalid logout request")
+
+// LogoutParams holds the parameters of an end session request (OpenID Connect
+// RP-Initiated Logout 1.0 section 2)
+type LogoutParams struct {
+	IDTokenHint           string
+	ClientID              string
+	PostLogoutRedirectURI string
+	State                 string
+}
+
+// LogoutRequest is a validated end session request
+type LogoutRequest struct {
+	ClientID   string
+	ClientName string
+	// PostLogoutRedirectURI is empty if the user stays on the service
+	PostLogoutRedirectURI string
+	State                 string
+	// Subject is the "sub" of the id_token_hint, or empty without a hint
+	Subject string
+}
+
+// ValidateLogoutRequest checks an end session request. The client is taken
+// from client_id or the audience of the id_token_hint, and is required to
+// redirect to one of its post_logout_redirect_uris afterwards.
+func (o *OAuthService) ValidateLogoutRequest(ctx context.Context, params *LogoutParams) (*LogoutRequest, error) {
+	logoutRequest := &LogoutRequest{
+		ClientID:              params.ClientID,
+		PostLogoutRedirectURI: params.PostLogoutRedirectURI,
+		State:                 params.State,
+	}
+
+	if params.IDTokenHint != "" {
+		subject, audience, err := o.parseIDTokenHint(params.IDTokenHint)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid id_token_hint", ErrInvalidLogoutRequest)
+		}
+		switch {
+		case logoutRequest.ClientID == "" && len(audience) == 1:
+			logoutRequest.ClientID = audience[0]
+		case logoutRequest.ClientID != "" && !slices.Contains(audience, logoutRequest.ClientID):
+			return nil, fmt.Errorf("%w: id_token_hint was not issued to client_id", ErrInvalidLogoutRequest)
+		}
+		logoutRequest.Subject = subject
+	}
+
+	if logoutRequest.ClientID != "" {
+		client, err := o.lookupClient(ctx, logoutRequest.ClientID)
+		if err != nil {
+			return nil, err
+		}
+		if client == nil || client.Disabled {
+			return nil, fmt.Errorf("%w: unknown client_id", ErrInvalidLogoutRequest)
+		}
+		logoutRequest.ClientName = client.Name
+
+		if logoutRequest.PostLogoutRedirectURI != "" && !slices.Contains(client.PostLogoutRedirectURIs, logoutRequest.PostLogoutRedirectURI) {
+			return nil, fmt.Errorf("%w: post_logout_redirect_uri is not registered for the client", ErrInvalidLogoutRequest)
+		}
+	} else if logoutRequest.PostLogoutRedirectURI != "" {
+		return nil, fmt.Errorf("%w: post_logout_redirect_uri requires client_id or id_token_hint", ErrInvalidLogoutRequest)
+	}
+
+	return logoutRequest, nil
+}
+
+// LogoutConfirmationToken returns the token the logout confirmation form posts
+// back. It is derived from the session ID, which only the user's browser
+// holds, so another site can't forge a confirmation.
+func LogoutConfirmationToken(sessionID string) string {
+	sum := sha256.Sum256([]byte("logout:" + sessionID))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// VerifyLogoutConfirmationToken checks a token posted by the logout
+// confirmation form against the session it was shown for
+func VerifyLogoutConfirmationToken(sessionID, token string) bool {
+	return subtle.ConstantTimeCompare([]byte(LogoutConfirmationToken(sessionID)), []byte(token)) == 1
+}
+
+// LogoutRedirectURL returns where to send the user after signing out, or an
+// empty string if the client didn't ask to get them back
+func (o *OAuthService) LogoutRedirectURL(logoutRequest *LogoutRequest) string {
+	if logoutRequest.PostLogoutRedirectURI == "" {
+		return ""
+	}
+
+	params := url.Values{}
+	if logoutRequest.State != "" {
+		params.Set("state", logoutRequest.State)
+	}
+	return o.BuildResponseURL(logoutRequest.PostLogoutRedirectURI, models.ResponseModeQuery, params)
+}
+
+// parseIDTokenHint verifies an ID token this service issued and returns its
+// subject and audience. Expired ID tokens are accepted, as the user may have
+// been signed in for longer than the token lifetime.
+func (o *OAuthService) parseIDTokenHint(token string) (string, []string, error) {
+	parsed, err := jwt.Parse(token, o.keyManager.Keyfunc, jwt.WithoutClaimsValidation())
+	if err != nil {
+		return "", nil, err
+	}
+	if typ, _ := parsed.Header["typ"].(string); typ == accessTokenType {
+		return "", nil, fmt.Errorf("access token used as id_token_hint")
+	}
+
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", nil, fmt.Errorf("unexpected claims")
+	}
+	if issuer, _ := claims.GetIssuer(); issuer != o.options.Issuer {
+		return "", nil, fmt.Errorf("unexpected issuer %q", issuer)
+	}
+	subject, _ := claims.GetSubject()
+	audience, _ := claims.GetAudience()
+	if subject == "" || len(audience) == 0 {
+		return "", nil, fmt.Errorf("missing sub or aud")
+	}
+
+	return subject, audience, nil
+}
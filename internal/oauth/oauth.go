@@ -5,95 +5,256 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
-	"net/url"
+	"log/slog"
+	"net/http"
 	"time"
 
+	"github.com/andyleap/passkey/internal/keys"
 	"github.com/andyleap/passkey/internal/models"
 	"github.com/andyleap/passkey/internal/storage"
 )
 
+// Options configures optional OAuth server behaviour
+type Options struct {
+	// Issuer is the OpenID Connect issuer identifier (the service's base URL)
+	Issuer string
+	// AllowPlainPKCE permits the "plain" code_challenge_method
+	AllowPlainPKCE bool
+	// AccessTokenLifetime defaults to one hour
+	AccessTokenLifetime time.Duration
+	// RefreshTokenLifetime defaults to 30 days
+	RefreshTokenLifetime time.Duration
+	// RegistrationToken is the initial access token required to register
+	// clients; dynamic registration is disabled when it is empty
+	RegistrationToken string
+}
+
 type OAuthService struct {
 	sessionStorage storage.SessionStorage
-	clients        map[string]*models.Client
+	userStorage    storage.UserStorage
+	consentStorage storage.ConsentStorage
+	clientStorage  storage.ClientStorage
+	keyManager     *keys.Manager
+	options        Options
+	// httpClient makes requests to clients, such as back-channel logouts
+	httpClient *http.Client
+	// jwksCache holds the keys of private_key_jwt clients with a jwks_uri
+	jwksCache *jwksCache
+	// dpopNonces is the nonce currently handed out for DPoP proofs
+	dpopNonces *dpopNonceSource
+	// backchannelWake prompts StartBackchannelLogout to deliver newly queued
+	// logout tokens without waiting for its next poll
+	backchannelWake chan struct{}
 }
 
-func NewOAuthService(sessionStorage storage.SessionStorage, clients map[string]*models.Client) *OAuthService {
-	// Set CreatedAt for all clients if not set
-	for _, client := range clients {
-		if client.CreatedAt.IsZero() {
-			client.CreatedAt = time.Now()
-		}
+func NewOAuthService(sessionStorage storage.SessionStorage, userStorage storage.UserStorage, consentStorage storage.ConsentStorage, clientStorage storage.ClientStorage, keyManager *keys.Manager, options Options) *OAuthService {
+	if options.AccessTokenLifetime <= 0 {
+		options.AccessTokenLifetime = defaultAccessTokenLifetime
+	}
+	if options.RefreshTokenLifetime <= 0 {
+		options.RefreshTokenLifetime = defaultRefreshTokenLifetime
 	}
 
 	return &OAuthService{
 		sessionStorage: sessionStorage,
-		clients:        clients,
+		userStorage:    userStorage,
+		consentStorage: consentStorage,
+		clientStorage:  clientStorage,
+		keyManager:     keyManager,
+		options:        options,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+			// Clients' endpoints are registered exactly, so don't follow
+			// them elsewhere
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		jwksCache:       newJWKSCache(),
+		dpopNonces:      &dpopNonceSource{},
+		backchannelWake: make(chan struct{}, 1),
 	}
 }
 
 // ValidateAuthorizationRequest validates an OAuth authorization request
-func (o *OAuthService) ValidateAuthorizationRequest(clientID, redirectURI string) (*models.Client, error) {
-	client, exists := o.clients[clientID]
-	if !exists {
+func (o *OAuthService) ValidateAuthorizationRequest(ctx context.Context, clientID, redirectURI string) (*models.Client, error) {
+	client, err := o.lookupClient(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
 		return nil, fmt.Errorf("invalid client_id")
 	}
-
-	// Validate redirect URI
-	validURI := false
-	for _, uri := range client.RedirectURIs {
-		if uri == redirectURI {
-			validURI = true
-			break
-		}
+	if client.Disabled {
+		return nil, fmt.Errorf("client is disabled")
 	}
-	if !validURI {
+
+	if !redirectURIAllowed(client, redirectURI) {
 		return nil, fmt.Errorf("invalid redirect_uri")
 	}
 
 	return client, nil
 }
 
-// CreateAuthorizationRequest creates a new authorization request
-func (o *OAuthService) CreateAuthorizationRequest(clientID, redirectURI, state string) (*models.AuthorizationRequest, error) {
-	client, err := o.ValidateAuthorizationRequest(clientID, redirectURI)
+// AuthorizationParams holds the parameters of an /authorize request
+type AuthorizationParams struct {
+	ClientID            string
+	RedirectURI         string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Scope               string
+	Nonce               string
+	Prompt              string
+	// MaxAge is the max_age parameter in seconds, nil if not sent
+	MaxAge       *int
+	LoginHint    string
+	ResponseMode string
+	// Pushed is set when the parameters came from a pushed authorization
+	// request rather than the /authorize query string
+	Pushed bool
+}
+
+// AuthorizationError is an error that should be reported back to the client
+// via its redirect URI
+type AuthorizationError struct {
+	Code        string
+	Description string
+}
+
+func (e *AuthorizationError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+// CreateAuthorizationRequest creates a new authorization request and stores it
+// until the user completes authentication
+func (o *OAuthService) CreateAuthorizationRequest(ctx context.Context, params AuthorizationParams) (*models.AuthorizationRequest, error) {
+	client, err := o.ValidateAuthorizationRequest(ctx, params.ClientID, params.RedirectURI)
 	if err != nil {
 		return nil, err
 	}
+	if client.RequirePAR && !params.Pushed {
+		return nil, &AuthorizationError{Code: "invalid_request", Description: "this client must use pushed authorization requests"}
+	}
 
-	request := &models.AuthorizationRequest{
-		ClientID:    client.ID,
-		RedirectURI: redirectURI,
-		State:       state,
-		CreatedAt:   time.Now(),
-		ExpiresAt:   time.Now().Add(10 * time.Minute), // 10 minute expiry
+	request, err := o.validateAuthorizationParams(client, params)
+	if err != nil {
+		return nil, err
+	}
+	request.ID = generateRandomCode(32)
+	request.CreatedAt = time.Now()
+	request.ExpiresAt = time.Now().Add(10 * time.Minute) // 10 minute expiry
+
+	if err := o.sessionStorage.SaveAuthorizationRequest(ctx, request); err != nil {
+		return nil, fmt.Errorf("failed to save authorization request: %w", err)
 	}
 
 	return request, nil
 }
 
-// CreateAuthorizationCode creates an authorization code after successful authentication
-func (o *OAuthService) CreateAuthorizationCode(ctx context.Context, request *models.AuthorizationRequest, user *models.User) (*models.AuthorizationCode, error) {
+// validateAuthorizationParams checks the request parameters against the
+// client and returns them normalized, without an ID or expiry
+func (o *OAuthService) validateAuthorizationParams(client *models.Client, params AuthorizationParams) (*models.AuthorizationRequest, error) {
+	challengeMethod, err := o.validateCodeChallenge(client, params.CodeChallenge, params.CodeChallengeMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	scope, err := validateScope(client, params.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	prompt, err := validatePrompt(params.Prompt)
+	if err != nil {
+		return nil, err
+	}
+	if params.MaxAge != nil && *params.MaxAge < 0 {
+		return nil, &AuthorizationError{Code: "invalid_request", Description: "max_age must not be negative"}
+	}
+
+	responseMode, err := ResolveResponseMode(client, params.ResponseMode)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AuthorizationRequest{
+		ClientID:            client.ID,
+		RedirectURI:         params.RedirectURI,
+		State:               params.State,
+		CodeChallenge:       params.CodeChallenge,
+		CodeChallengeMethod: challengeMethod,
+		Scope:               scope,
+		Nonce:               params.Nonce,
+		Prompt:              prompt,
+		MaxAge:              params.MaxAge,
+		LoginHint:           params.LoginHint,
+		ResponseMode:        responseMode,
+	}, nil
+}
+
+// GetAuthorizationRequest returns a pending authorization request without
+// consuming it, for display on the consent page
+func (o *OAuthService) GetAuthorizationRequest(ctx context.Context, requestID string) (*models.AuthorizationRequest, error) {
+	request, err := o.sessionStorage.GetAuthorizationRequest(ctx, requestID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get authorization request: %w", err)
+	}
+	if request == nil || time.Now().After(request.ExpiresAt) {
+		return nil, fmt.Errorf("invalid or expired authorization request")
+	}
+
+	return request, nil
+}
+
+// ConsumeAuthorizationRequest retrieves a pending authorization request and
+// removes it so it can only be completed once
+func (o *OAuthService) ConsumeAuthorizationRequest(ctx context.Context, requestID string) (*models.AuthorizationRequest, error) {
+	request, err := o.sessionStorage.ConsumeAuthorizationRequest(ctx, requestID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume authorization request: %w", err)
+	}
+	if request == nil || time.Now().After(request.ExpiresAt) {
+		return nil, fmt.Errorf("invalid or expired authorization request")
+	}
+
+	// Re-validate in case the client configuration changed since the request was made
+	client, err := o.ValidateAuthorizationRequest(ctx, request.ClientID, request.RedirectURI)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := validateScope(client, request.Scope); err != nil {
+		return nil, err
+	}
+
+	return request, nil
+}
+
+// CreateAuthorizationCode creates an authorization code for the user of an
+// authenticated session
+func (o *OAuthService) CreateAuthorizationCode(ctx context.Context, request *models.AuthorizationRequest, session *models.Session) (*models.AuthorizationCode, error) {
+	if !SessionSatisfies(request, session) {
+		return nil, fmt.Errorf("session does not satisfy prompt or max_age of the request")
+	}
+
 	code := &models.AuthorizationCode{
-		Code:        generateRandomCode(32),
-		ClientID:    request.ClientID,
-		RedirectURI: request.RedirectURI,
-		State:       request.State,
-		Username:    user.Name,
-		UserID:      user.ID,
-		CreatedAt:   time.Now(),
-		ExpiresAt:   time.Now().Add(10 * time.Minute), // 10 minute expiry
-	}
-
-	// Store the authorization code in session storage with a special key
-	codeSession := &models.Session{
-		ID:        "auth_code:" + code.Code,
-		Username:  user.Name,
-		UserID:    user.ID,
-		CreatedAt: code.CreatedAt,
-		ExpiresAt: code.ExpiresAt,
-	}
-
-	if err := o.sessionStorage.SaveSession(ctx, codeSession); err != nil {
+		Code:                generateRandomCode(32),
+		ClientID:            request.ClientID,
+		RedirectURI:         request.RedirectURI,
+		State:               request.State,
+		CodeChallenge:       request.CodeChallenge,
+		CodeChallengeMethod: request.CodeChallengeMethod,
+		Scope:               request.Scope,
+		Nonce:               request.Nonce,
+		Username:            session.Username,
+		UserID:              session.UserID,
+		SessionID:           session.ID,
+		AuthTime:            session.AuthenticatedAt(),
+		CreatedAt:           time.Now(),
+		ExpiresAt:           time.Now().Add(10 * time.Minute), // 10 minute expiry
+	}
+
+	if err := o.sessionStorage.SaveAuthorizationCode(ctx, code); err != nil {
 		return nil, fmt.Errorf("failed to save authorization code: %w", err)
 	}
 
@@ -101,33 +262,45 @@ func (o *OAuthService) CreateAuthorizationCode(ctx context.Context, request *mod
 }
 
 // ExchangeAuthorizationCode exchanges an authorization code for user information
-func (o *OAuthService) ExchangeAuthorizationCode(ctx context.Context, code, clientID, redirectURI string) (*models.AuthorizationCode, error) {
-	// Validate client and redirect URI
-	_, err := o.ValidateAuthorizationRequest(clientID, redirectURI)
+func (o *OAuthService) ExchangeAuthorizationCode(ctx context.Context, code, redirectURI, codeVerifier string, clientAuth *ClientAuth) (*models.AuthorizationCode, error) {
+	// Confidential clients must prove possession of their secret
+	client, err := o.AuthenticateClient(ctx, clientAuth)
 	if err != nil {
 		return nil, err
 	}
 
-	// Retrieve the authorization code
-	session, err := o.sessionStorage.GetSession(ctx, "auth_code:"+code)
+	// Checked before the code is consumed, so the client can retry with a
+	// proof
+	if err := checkDPoPRequired(client, clientAuth); err != nil {
+		return nil, err
+	}
+
+	// Validate client and redirect URI
+	_, err = o.ValidateAuthorizationRequest(ctx, clientAuth.ClientID, redirectURI)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidGrant, err)
+	}
+
+	// Retrieve and delete the authorization code (single use)
+	authCode, err := o.sessionStorage.ConsumeAuthorizationCode(ctx, code)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get authorization code: %w", err)
 	}
-	if session == nil {
-		return nil, fmt.Errorf("invalid or expired authorization code")
+	if authCode == nil || time.Now().After(authCode.ExpiresAt) {
+		return nil, fmt.Errorf("%w: invalid or expired authorization code", ErrInvalidGrant)
 	}
 
-	// Delete the code (single use)
-	o.sessionStorage.DeleteSession(ctx, "auth_code:"+code)
+	// The code may only be redeemed by the client it was issued to, with the
+	// same redirect URI used in the authorization request
+	if authCode.ClientID != clientAuth.ClientID {
+		return nil, fmt.Errorf("%w: authorization code was issued to another client", ErrInvalidGrant)
+	}
+	if authCode.RedirectURI != redirectURI {
+		return nil, fmt.Errorf("%w: redirect_uri does not match authorization request", ErrInvalidGrant)
+	}
 
-	authCode := &models.AuthorizationCode{
-		Code:        code,
-		ClientID:    clientID,
-		RedirectURI: redirectURI,
-		Username:    session.Username,
-		UserID:      session.UserID,
-		CreatedAt:   session.CreatedAt,
-		ExpiresAt:   session.ExpiresAt,
+	if err := verifyCodeVerifier(authCode, codeVerifier); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidGrant, err)
 	}
 
 	return authCode, nil
@@ -135,45 +308,37 @@ func (o *OAuthService) ExchangeAuthorizationCode(ctx context.Context, code, clie
 
 // BuildRedirectURL builds the callback URL with code and state
 func (o *OAuthService) BuildRedirectURL(redirectURI, code, state string) string {
-	u, err := url.Parse(redirectURI)
-	if err != nil {
-		return redirectURI // fallback
-	}
-
-	q := u.Query()
-	q.Set("code", code)
-	if state != "" {
-		q.Set("state", state)
-	}
-	u.RawQuery = q.Encode()
-
-	return u.String()
+	return o.BuildResponseURL(redirectURI, models.ResponseModeQuery, CodeResponseParams(code, state))
 }
 
 // BuildErrorRedirectURL builds a callback URL with error information
 func (o *OAuthService) BuildErrorRedirectURL(redirectURI, errorCode, errorDescription, state string) string {
-	u, err := url.Parse(redirectURI)
+	return o.BuildResponseURL(redirectURI, models.ResponseModeQuery, ErrorResponseParams(errorCode, errorDescription, state))
+}
+
+// GetClient returns a client by ID
+func (o *OAuthService) GetClient(ctx context.Context, clientID string) (*models.Client, bool) {
+	client, err := o.lookupClient(ctx, clientID)
 	if err != nil {
-		return redirectURI // fallback
+		slog.Error("Failed to look up client", "client_id", clientID, "error", err)
+		return nil, false
 	}
+	return client, client != nil
+}
 
-	q := u.Query()
-	q.Set("error", errorCode)
-	if errorDescription != "" {
-		q.Set("error_description", errorDescription)
-	}
-	if state != "" {
-		q.Set("state", state)
+// lookupClient finds a client in the client registry, returning nil if there
+// is none
+func (o *OAuthService) lookupClient(ctx context.Context, clientID string) (*models.Client, error) {
+	if clientID == "" {
+		return nil, nil
 	}
-	u.RawQuery = q.Encode()
 
-	return u.String()
-}
+	client, err := o.clientStorage.GetClient(ctx, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client: %w", err)
+	}
 
-// GetClient returns a client by ID
-func (o *OAuthService) GetClient(clientID string) (*models.Client, bool) {
-	client, exists := o.clients[clientID]
-	return client, exists
+	return client, nil
 }
 
 func generateRandomCode(length int) string {
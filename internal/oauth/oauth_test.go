@@ -0,0 +1,45 @@
+package oauth
+
+import (
+	"testing"
+
+	"github.com/andyleap/passkey/internal/models"
+	"github.com/andyleap/passkey/internal/storage"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newTestService returns a service backed by memory session storage and
+// filesystem user storage, with a public client "app" and a confidential
+// client "service" whose secret is "secret"
+func newTestService(t *testing.T) (*OAuthService, *storage.MemoryStorage) {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clients := map[string]*models.Client{
+		"app": {
+			ID:                      "app",
+			Name:                    "App",
+			RedirectURIs:            []string{"https://app.example.com/callback"},
+			TokenEndpointAuthMethod: "none",
+		},
+		"service": {
+			ID:                      "service",
+			Name:                    "Service",
+			RedirectURIs:            []string{"https://service.example.com/callback"},
+			TokenEndpointAuthMethod: "client_secret_basic",
+			ClientSecretHashes:      []string{string(hash)},
+		},
+	}
+
+	userStorage, err := storage.NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessionStorage := storage.NewMemoryStorage()
+	return NewOAuthService(sessionStorage, userStorage, userStorage, storage.NewConfigClientStorage(clients, userStorage), nil, Options{}), sessionStorage
+}
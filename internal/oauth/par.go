@@ -0,0 +1,114 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/andyleap/passkey/internal/models"
+)
+
+// RequestURIPrefix is the URN prefix of request_uri values issued by the
+// pushed authorization request endpoint (RFC 9126 section 2.2)
+const RequestURIPrefix = "urn:ietf:params:oauth:request_uri:"
+
+// pushedRequestLifetime is how long a client has to send the user to
+// /authorize with a request_uri. It only needs to cover the redirect.
+const pushedRequestLifetime = 60 * time.Second
+
+// ErrInvalidRequestURI is returned when a request_uri is unknown, expired,
+// already used or belongs to another client
+var ErrInvalidRequestURI = errors.New("invalid request_uri")
+
+// PushedAuthorizationResponse is the response of the pushed authorization
+// request endpoint (RFC 9126 section 2.2)
+type PushedAuthorizationResponse struct {
+	RequestURI string `json:"request_uri"`
+	ExpiresIn  int    `json:"expires_in"`
+}
+
+// PushAuthorizationRequest validates an authorization request sent directly by
+// an authenticated client and stores it until it is redeemed at /authorize
+func (o *OAuthService) PushAuthorizationRequest(ctx context.Context, params AuthorizationParams, clientAuth *ClientAuth) (*PushedAuthorizationResponse, error) {
+	client, err := o.AuthenticateClient(ctx, clientAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.RedirectURI == "" {
+		return nil, &AuthorizationError{Code: "invalid_request", Description: "redirect_uri is required"}
+	}
+	if !redirectURIAllowed(client, params.RedirectURI) {
+		return nil, &AuthorizationError{Code: "invalid_request", Description: "invalid redirect_uri"}
+	}
+
+	// Validate now so the client hears about errors directly, and again when
+	// the request is redeemed in case the client configuration changed
+	request, err := o.validateAuthorizationParams(client, params)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	pushed := &models.PushedAuthorizationRequest{
+		RequestURI:          RequestURIPrefix + generateRandomCode(32),
+		ClientID:            client.ID,
+		RedirectURI:         request.RedirectURI,
+		State:               request.State,
+		CodeChallenge:       request.CodeChallenge,
+		CodeChallengeMethod: request.CodeChallengeMethod,
+		Scope:               request.Scope,
+		Nonce:               request.Nonce,
+		Prompt:              request.Prompt,
+		MaxAge:              request.MaxAge,
+		LoginHint:           request.LoginHint,
+		ResponseMode:        request.ResponseMode,
+		CreatedAt:           now,
+		ExpiresAt:           now.Add(pushedRequestLifetime),
+	}
+
+	if err := o.sessionStorage.SavePushedAuthorizationRequest(ctx, pushed); err != nil {
+		return nil, fmt.Errorf("failed to save pushed authorization request: %w", err)
+	}
+
+	return &PushedAuthorizationResponse{
+		RequestURI: pushed.RequestURI,
+		ExpiresIn:  int(pushedRequestLifetime.Seconds()),
+	}, nil
+}
+
+// ResolvePushedAuthorizationRequest redeems a request_uri sent to /authorize
+// and returns the pushed parameters. Each request_uri can only be used once.
+func (o *OAuthService) ResolvePushedAuthorizationRequest(ctx context.Context, clientID, requestURI string) (*AuthorizationParams, error) {
+	if !strings.HasPrefix(requestURI, RequestURIPrefix) {
+		return nil, fmt.Errorf("%w: unrecognized request_uri", ErrInvalidRequestURI)
+	}
+
+	pushed, err := o.sessionStorage.ConsumePushedAuthorizationRequest(ctx, requestURI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pushed authorization request: %w", err)
+	}
+	if pushed == nil || time.Now().After(pushed.ExpiresAt) {
+		return nil, fmt.Errorf("%w: request_uri is invalid, expired or already used", ErrInvalidRequestURI)
+	}
+	if pushed.ClientID != clientID {
+		return nil, fmt.Errorf("%w: request_uri was issued to another client", ErrInvalidRequestURI)
+	}
+
+	return &AuthorizationParams{
+		ClientID:            pushed.ClientID,
+		RedirectURI:         pushed.RedirectURI,
+		State:               pushed.State,
+		CodeChallenge:       pushed.CodeChallenge,
+		CodeChallengeMethod: pushed.CodeChallengeMethod,
+		Scope:               pushed.Scope,
+		Nonce:               pushed.Nonce,
+		Prompt:              pushed.Prompt,
+		MaxAge:              pushed.MaxAge,
+		LoginHint:           pushed.LoginHint,
+		ResponseMode:        pushed.ResponseMode,
+		Pushed:              true,
+	}, nil
+}
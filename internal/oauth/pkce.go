@@ -0,0 +1,97 @@
+package oauth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/andyleap/passkey/internal/models"
+)
+
+// PKCE code challenge methods (RFC 7636)
+const (
+	CodeChallengeMethodS256  = "S256"
+	CodeChallengeMethodPlain = "plain"
+)
+
+// validateCodeChallenge checks the PKCE parameters of an authorization request
+// and returns the effective challenge method
+func (o *OAuthService) validateCodeChallenge(client *models.Client, challenge, method string) (string, error) {
+	if challenge == "" {
+		if method != "" {
+			return "", &AuthorizationError{Code: "invalid_request", Description: "code_challenge_method without code_challenge"}
+		}
+		if client.RequirePKCE {
+			return "", &AuthorizationError{Code: "invalid_request", Description: "code_challenge is required"}
+		}
+		return "", nil
+	}
+
+	// RFC 7636 section 4.3: defaults to "plain" when not present
+	if method == "" {
+		method = CodeChallengeMethodPlain
+	}
+
+	switch method {
+	case CodeChallengeMethodS256:
+	case CodeChallengeMethodPlain:
+		if !o.options.AllowPlainPKCE {
+			return "", &AuthorizationError{Code: "invalid_request", Description: "code_challenge_method plain is not allowed"}
+		}
+	default:
+		return "", &AuthorizationError{Code: "invalid_request", Description: "unsupported code_challenge_method"}
+	}
+
+	if !isPKCEValue(challenge) {
+		return "", &AuthorizationError{Code: "invalid_request", Description: "malformed code_challenge"}
+	}
+
+	return method, nil
+}
+
+// verifyCodeVerifier checks the code_verifier presented at the token endpoint
+// against the challenge the code was issued for
+func verifyCodeVerifier(authCode *models.AuthorizationCode, verifier string) error {
+	if authCode.CodeChallenge == "" {
+		if verifier != "" {
+			return fmt.Errorf("code_verifier sent for a code issued without code_challenge")
+		}
+		return nil
+	}
+
+	if verifier == "" {
+		return fmt.Errorf("code_verifier is required")
+	}
+	if !isPKCEValue(verifier) {
+		return fmt.Errorf("malformed code_verifier")
+	}
+
+	expected := verifier
+	if authCode.CodeChallengeMethod == CodeChallengeMethodS256 {
+		sum := sha256.Sum256([]byte(verifier))
+		expected = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(authCode.CodeChallenge)) != 1 {
+		return fmt.Errorf("code_verifier does not match code_challenge")
+	}
+
+	return nil
+}
+
+// isPKCEValue reports whether s is 43-128 characters from the unreserved set
+func isPKCEValue(s string) bool {
+	if len(s) < 43 || len(s) > 128 {
+		return false
+	}
+	for _, c := range s {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case c == '-', c == '.', c == '_', c == '~':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,111 @@
+package oauth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/andyleap/passkey/internal/models"
+)
+
+func s256Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestValidateCodeChallenge(t *testing.T) {
+	verifier := strings.Repeat("a", 43)
+	challenge := s256Challenge(verifier)
+
+	tests := []struct {
+		name       string
+		allowPlain bool
+		client     *models.Client
+		challenge  string
+		method     string
+		wantMethod string
+		wantErr    bool
+	}{
+		{name: "S256", challenge: challenge, method: "S256", wantMethod: "S256"},
+		{name: "plain", allowPlain: true, challenge: verifier, method: "plain", wantMethod: "plain"},
+		{name: "method defaults to plain", allowPlain: true, challenge: verifier, wantMethod: "plain"},
+		{name: "plain disabled", challenge: verifier, method: "plain", wantErr: true},
+		{name: "default plain disabled", challenge: verifier, wantErr: true},
+		{name: "unsupported method", allowPlain: true, challenge: verifier, method: "S512", wantErr: true},
+		{name: "shortest challenge", allowPlain: true, challenge: strings.Repeat("a", 43), method: "plain", wantMethod: "plain"},
+		{name: "longest challenge", allowPlain: true, challenge: strings.Repeat("a", 128), method: "plain", wantMethod: "plain"},
+		{name: "challenge too short", allowPlain: true, challenge: strings.Repeat("a", 42), method: "plain", wantErr: true},
+		{name: "challenge too long", allowPlain: true, challenge: strings.Repeat("a", 129), method: "plain", wantErr: true},
+		{name: "challenge outside unreserved set", allowPlain: true, challenge: strings.Repeat("a", 42) + "+", method: "plain", wantErr: true},
+		{name: "no challenge", wantMethod: ""},
+		{name: "method without challenge", method: "S256", wantErr: true},
+		{name: "challenge required by client", client: &models.Client{RequirePKCE: true}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &OAuthService{options: Options{AllowPlainPKCE: tt.allowPlain}}
+			client := tt.client
+			if client == nil {
+				client = &models.Client{}
+			}
+
+			method, err := o.validateCodeChallenge(client, tt.challenge, tt.method)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("validateCodeChallenge() = %q, want error", method)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("validateCodeChallenge() error = %v", err)
+			}
+			if method != tt.wantMethod {
+				t.Errorf("validateCodeChallenge() = %q, want %q", method, tt.wantMethod)
+			}
+		})
+	}
+}
+
+func TestVerifyCodeVerifier(t *testing.T) {
+	verifier := strings.Repeat("a", 43) + "-._~"
+	longVerifier := strings.Repeat("b", 128)
+
+	tests := []struct {
+		name      string
+		challenge string
+		method    string
+		verifier  string
+		wantErr   bool
+	}{
+		{name: "S256", challenge: s256Challenge(verifier), method: "S256", verifier: verifier},
+		{name: "S256 longest verifier", challenge: s256Challenge(longVerifier), method: "S256", verifier: longVerifier},
+		{name: "S256 wrong verifier", challenge: s256Challenge(verifier), method: "S256", verifier: longVerifier, wantErr: true},
+		{name: "S256 challenge sent as verifier", challenge: s256Challenge(verifier), method: "S256", verifier: s256Challenge(verifier), wantErr: true},
+		{name: "plain", challenge: verifier, method: "plain", verifier: verifier},
+		{name: "plain wrong verifier", challenge: verifier, method: "plain", verifier: longVerifier, wantErr: true},
+		{name: "verifier too short", challenge: s256Challenge(strings.Repeat("a", 42)), method: "S256", verifier: strings.Repeat("a", 42), wantErr: true},
+		{name: "verifier too long", challenge: s256Challenge(strings.Repeat("a", 129)), method: "S256", verifier: strings.Repeat("a", 129), wantErr: true},
+		{name: "missing verifier", challenge: s256Challenge(verifier), method: "S256", wantErr: true},
+		{name: "no challenge and no verifier"},
+		{name: "verifier without challenge", verifier: verifier, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authCode := &models.AuthorizationCode{
+				CodeChallenge:       tt.challenge,
+				CodeChallengeMethod: tt.method,
+			}
+
+			err := verifyCodeVerifier(authCode, tt.verifier)
+			if tt.wantErr && err == nil {
+				t.Error("verifyCodeVerifier() = nil, want error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("verifyCodeVerifier() error = %v", err)
+			}
+		})
+	}
+}
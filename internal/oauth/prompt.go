@@ -0,0 +1,67 @@
+package oauth
+
+import (
+	"strings"
+	"time"
+
+	"github.com/andyleap/passkey/internal/models"
+)
+
+// OpenID Connect prompt values
+const (
+	PromptNone          = "none"
+	PromptLogin         = "login"
+	PromptConsent       = "consent"
+	PromptSelectAccount = "select_account"
+)
+
+// validatePrompt checks the space-delimited prompt parameter and returns it
+// normalized
+func validatePrompt(prompt string) (string, error) {
+	values := strings.Fields(prompt)
+	for _, value := range values {
+		switch value {
+		case PromptNone, PromptLogin, PromptConsent, PromptSelectAccount:
+		default:
+			return "", &AuthorizationError{Code: "invalid_request", Description: "unsupported prompt value"}
+		}
+		// OIDC Core section 3.1.2.1: none must not be combined with other values
+		if value == PromptNone && len(values) > 1 {
+			return "", &AuthorizationError{Code: "invalid_request", Description: "prompt=none cannot be combined with other values"}
+		}
+	}
+
+	return strings.Join(values, " "), nil
+}
+
+// HasPrompt reports whether the request carries the given prompt value
+func HasPrompt(request *models.AuthorizationRequest, value string) bool {
+	for _, p := range strings.Fields(request.Prompt) {
+		if p == value {
+			return true
+		}
+	}
+	return false
+}
+
+// SessionSatisfies reports whether the user's existing session can be used
+// for the request, or the user must authenticate again: prompt=login and
+// prompt=select_account require a sign-in after the request was made, and
+// max_age limits how long ago the user may have authenticated.
+func SessionSatisfies(request *models.AuthorizationRequest, session *models.Session) bool {
+	authTime := session.AuthenticatedAt()
+
+	if HasPrompt(request, PromptLogin) || HasPrompt(request, PromptSelectAccount) {
+		if authTime.Before(request.CreatedAt) {
+			return false
+		}
+	}
+
+	if request.MaxAge != nil {
+		if time.Since(authTime) > time.Duration(*request.MaxAge)*time.Second {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,89 @@
+package oauth
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/andyleap/passkey/internal/models"
+)
+
+// redirectURIAllowed reports whether a requested redirect URI matches one of
+// the client's registered URIs. Native apps may use any port on a loopback IP
+// address, as they listen on whatever port is free (RFC 8252 section 7.3).
+// "localhost" is matched exactly: the spec recommends against it, since it
+// may not resolve to the loopback interface (section 8.3).
+func redirectURIAllowed(client *models.Client, redirectURI string) bool {
+	if slices.Contains(client.RedirectURIs, redirectURI) {
+		return true
+	}
+	if !client.NativeApp {
+		return false
+	}
+
+	requested, err := url.Parse(redirectURI)
+	if err != nil || requested.User != nil || requested.Fragment != "" || !isLoopbackIP(requested.Hostname()) {
+		return false
+	}
+
+	for _, uri := range client.RedirectURIs {
+		registered, err := url.Parse(uri)
+		if err != nil {
+			continue
+		}
+		if registered.Scheme == requested.Scheme &&
+			registered.Hostname() == requested.Hostname() &&
+			registered.EscapedPath() == requested.EscapedPath() &&
+			registered.RawQuery == requested.RawQuery {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidateRedirectURI checks a redirect URI a client is configured with.
+// Schemes other than http and https are only allowed for native apps, which
+// must use a private-use scheme named after a domain they control, like
+// com.example.app:/callback (RFC 8252 section 7.1).
+func ValidateRedirectURI(client *models.Client, redirectURI string) error {
+	u, err := url.Parse(redirectURI)
+	if err != nil || u.Scheme == "" {
+		return fmt.Errorf("must be an absolute URI")
+	}
+	if u.Fragment != "" {
+		return fmt.Errorf("must not contain a fragment")
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		if u.Host == "" {
+			return fmt.Errorf("must be an absolute URI")
+		}
+		return nil
+	}
+
+	if !client.NativeApp {
+		return fmt.Errorf("scheme %q is only allowed for native apps", u.Scheme)
+	}
+	if !strings.Contains(u.Scheme, ".") {
+		return fmt.Errorf("private-use scheme %q must be a reverse domain name, like com.example.app", u.Scheme)
+	}
+
+	return nil
+}
+
+// IsLocalhostRedirectURI reports whether a redirect URI uses the "localhost"
+// host name, which RFC 8252 section 8.3 recommends native apps avoid in
+// favour of a loopback IP address
+func IsLocalhostRedirectURI(redirectURI string) bool {
+	u, err := url.Parse(redirectURI)
+	return err == nil && strings.EqualFold(u.Hostname(), "localhost")
+}
+
+func isLoopbackIP(host string) bool {
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,90 @@
+package oauth
+
+import (
+	"testing"
+
+	"github.com/andyleap/passkey/internal/models"
+)
+
+func TestRedirectURIAllowed(t *testing.T) {
+	native := &models.Client{
+		NativeApp: true,
+		RedirectURIs: []string{
+			"http://127.0.0.1/callback",
+			"http://[::1]/callback?app=cli",
+			"http://localhost:8080/callback",
+			"com.example.app:/callback",
+		},
+	}
+	web := &models.Client{
+		RedirectURIs: []string{
+			"https://app.example.com/callback",
+			"http://127.0.0.1/callback",
+		},
+	}
+
+	tests := []struct {
+		name        string
+		client      *models.Client
+		redirectURI string
+		want        bool
+	}{
+		{name: "exact match", client: web, redirectURI: "https://app.example.com/callback", want: true},
+		{name: "different path", client: web, redirectURI: "https://app.example.com/other", want: false},
+		{name: "web loopback needs exact port", client: web, redirectURI: "http://127.0.0.1:53682/callback", want: false},
+		{name: "native loopback any port", client: native, redirectURI: "http://127.0.0.1:53682/callback", want: true},
+		{name: "native loopback registered port", client: native, redirectURI: "http://127.0.0.1/callback", want: true},
+		{name: "native IPv6 loopback any port", client: native, redirectURI: "http://[::1]:53682/callback?app=cli", want: true},
+		{name: "native loopback query must match", client: native, redirectURI: "http://[::1]:53682/callback?app=other", want: false},
+		{name: "native loopback path must match", client: native, redirectURI: "http://127.0.0.1:53682/other", want: false},
+		{name: "native loopback scheme must match", client: native, redirectURI: "https://127.0.0.1:53682/callback", want: false},
+		{name: "native loopback host must match", client: native, redirectURI: "http://127.0.0.2:53682/callback", want: false},
+		{name: "native loopback with fragment", client: native, redirectURI: "http://127.0.0.1:53682/callback#frag", want: false},
+		{name: "native loopback with userinfo", client: native, redirectURI: "http://user@127.0.0.1:53682/callback", want: false},
+		{name: "native localhost exact", client: native, redirectURI: "http://localhost:8080/callback", want: true},
+		{name: "native localhost other port", client: native, redirectURI: "http://localhost:53682/callback", want: false},
+		{name: "native private-use scheme", client: native, redirectURI: "com.example.app:/callback", want: true},
+		{name: "native unregistered private-use scheme", client: native, redirectURI: "com.example.other:/callback", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redirectURIAllowed(tt.client, tt.redirectURI); got != tt.want {
+				t.Errorf("redirectURIAllowed(%q) = %v, want %v", tt.redirectURI, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateRedirectURI(t *testing.T) {
+	native := &models.Client{NativeApp: true}
+	web := &models.Client{}
+
+	tests := []struct {
+		name        string
+		client      *models.Client
+		redirectURI string
+		wantErr     bool
+	}{
+		{name: "https", client: web, redirectURI: "https://app.example.com/callback"},
+		{name: "loopback http", client: native, redirectURI: "http://127.0.0.1/callback"},
+		{name: "relative", client: web, redirectURI: "/callback", wantErr: true},
+		{name: "no host", client: web, redirectURI: "https:/callback", wantErr: true},
+		{name: "fragment", client: web, redirectURI: "https://app.example.com/callback#frag", wantErr: true},
+		{name: "private-use scheme", client: native, redirectURI: "com.example.app:/callback"},
+		{name: "private-use scheme for web client", client: web, redirectURI: "com.example.app:/callback", wantErr: true},
+		{name: "private-use scheme without domain", client: native, redirectURI: "myapp:/callback", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRedirectURI(tt.client, tt.redirectURI)
+			if tt.wantErr && err == nil {
+				t.Error("ValidateRedirectURI() = nil, want error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("ValidateRedirectURI() error = %v", err)
+			}
+		})
+	}
+}
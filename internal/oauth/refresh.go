@@ -0,0 +1,94 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// RefreshTokens redeems a refresh token for a new access token and a new
+// refresh token in the same family. Refresh tokens are single use: presenting
+// one a second time revokes every token of its family, since either the client
+// or an attacker is holding a stolen token.
+func (o *OAuthService) RefreshTokens(ctx context.Context, token, scope string, clientAuth *ClientAuth) (*TokenResponse, error) {
+	client, err := o.AuthenticateClient(ctx, clientAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := o.sessionStorage.GetRefreshToken(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+	if refreshToken == nil || time.Now().After(refreshToken.ExpiresAt) {
+		return nil, fmt.Errorf("%w: invalid or expired refresh token", ErrInvalidGrant)
+	}
+	if refreshToken.ClientID != client.ID {
+		return nil, fmt.Errorf("%w: refresh token was issued to another client", ErrInvalidGrant)
+	}
+	if err := checkDPoPRequired(client, clientAuth); err != nil {
+		return nil, err
+	}
+	if refreshToken.DPoPJKT != "" && refreshToken.DPoPJKT != clientAuth.DPoPJKT {
+		return nil, fmt.Errorf("%w: refresh token is bound to another DPoP key", ErrInvalidGrant)
+	}
+
+	revoked, err := o.tokenRevoked(ctx, refreshToken.FamilyID, refreshToken.Username, refreshToken.ClientID, refreshToken.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, fmt.Errorf("%w: refresh token has been revoked", ErrInvalidGrant)
+	}
+
+	// The client may narrow, but never widen, the original scope
+	scope = normalizeScope(scope)
+	for _, s := range strings.Fields(scope) {
+		if !HasScope(refreshToken.Scope, s) {
+			return nil, fmt.Errorf("%w: scope %q was not granted", ErrInvalidScope, s)
+		}
+	}
+
+	used, err := o.sessionStorage.MarkRefreshTokenUsed(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark refresh token used: %w", err)
+	}
+	if used {
+		slog.Warn("Refresh token reuse detected, revoking token family",
+			"client_id", client.ID, "username", refreshToken.Username, "family_id", refreshToken.FamilyID)
+		if err := o.RevokeTokenFamily(ctx, refreshToken.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: refresh token has already been used", ErrInvalidGrant)
+	}
+
+	return o.issueTokens(ctx, &tokenGrant{
+		FamilyID:    refreshToken.FamilyID,
+		ClientID:    refreshToken.ClientID,
+		Username:    refreshToken.Username,
+		UserID:      refreshToken.UserID,
+		Scope:       refreshToken.Scope,
+		AuthTime:    refreshToken.AuthTime,
+		SessionID:   refreshToken.SessionID,
+		AccessScope: scope,
+		DPoPJKT:     clientAuth.DPoPJKT,
+	})
+}
+
+// RevokeTokenFamily invalidates every access and refresh token descending from
+// the same authorization code
+func (o *OAuthService) RevokeTokenFamily(ctx context.Context, familyID string) error {
+	if err := o.sessionStorage.RevokeTokenFamily(ctx, familyID, time.Now().Add(o.maxTokenLifetime())); err != nil {
+		return fmt.Errorf("failed to revoke token family: %w", err)
+	}
+
+	return nil
+}
+
+// maxTokenLifetime is how long a revocation must be remembered to outlive
+// every token it covers
+func (o *OAuthService) maxTokenLifetime() time.Duration {
+	return max(o.options.RefreshTokenLifetime, o.options.AccessTokenLifetime)
+}
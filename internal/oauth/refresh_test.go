@@ -0,0 +1,157 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/andyleap/passkey/internal/models"
+)
+
+var publicClientAuth = &ClientAuth{ClientID: "app", Method: "none"}
+
+// issueTestTokens issues tokens to the public client as if an authorization
+// code for scope had been redeemed
+func issueTestTokens(t *testing.T, o *OAuthService, scope string) *TokenResponse {
+	t.Helper()
+
+	tokens, err := o.IssueTokens(context.Background(), &models.AuthorizationCode{
+		ClientID: "app",
+		Username: "alice",
+		UserID:   []byte("alice-id"),
+		Scope:    scope,
+		AuthTime: time.Now(),
+	}, "")
+	if err != nil {
+		t.Fatalf("IssueTokens() error = %v", err)
+	}
+	return tokens
+}
+
+func TestRefreshTokensRotation(t *testing.T) {
+	o, sessionStorage := newTestService(t)
+	ctx := context.Background()
+	first := issueTestTokens(t, o, "read write")
+
+	second, err := o.RefreshTokens(ctx, first.RefreshToken, "", publicClientAuth)
+	if err != nil {
+		t.Fatalf("RefreshTokens() error = %v", err)
+	}
+	if second.RefreshToken == "" || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("RefreshTokens() refresh token = %q, want a new token", second.RefreshToken)
+	}
+	if second.AccessToken == first.AccessToken {
+		t.Fatal("RefreshTokens() reused the access token")
+	}
+
+	used, err := sessionStorage.MarkRefreshTokenUsed(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("MarkRefreshTokenUsed() error = %v", err)
+	}
+	if !used {
+		t.Error("redeemed refresh token was not marked used")
+	}
+
+	if _, err := o.RefreshTokens(ctx, second.RefreshToken, "", publicClientAuth); err != nil {
+		t.Errorf("RefreshTokens() with the rotated token error = %v", err)
+	}
+}
+
+func TestRefreshTokensReuseRevokesFamily(t *testing.T) {
+	o, _ := newTestService(t)
+	ctx := context.Background()
+	first := issueTestTokens(t, o, "read")
+	other := issueTestTokens(t, o, "read")
+
+	second, err := o.RefreshTokens(ctx, first.RefreshToken, "", publicClientAuth)
+	if err != nil {
+		t.Fatalf("RefreshTokens() error = %v", err)
+	}
+
+	_, err = o.RefreshTokens(ctx, first.RefreshToken, "", publicClientAuth)
+	if !errors.Is(err, ErrInvalidGrant) {
+		t.Fatalf("RefreshTokens() with a used token error = %v, want ErrInvalidGrant", err)
+	}
+
+	// Every token of the family is revoked, including the ones issued to
+	// whoever redeemed the token first
+	if _, err := o.RefreshTokens(ctx, second.RefreshToken, "", publicClientAuth); !errors.Is(err, ErrInvalidGrant) {
+		t.Errorf("RefreshTokens() after reuse error = %v, want ErrInvalidGrant", err)
+	}
+	for _, accessToken := range []string{first.AccessToken, second.AccessToken} {
+		if _, err := o.ValidateAccessToken(ctx, accessToken); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("ValidateAccessToken() after reuse error = %v, want ErrInvalidToken", err)
+		}
+	}
+
+	// Other families are unaffected
+	if _, err := o.ValidateAccessToken(ctx, other.AccessToken); err != nil {
+		t.Errorf("ValidateAccessToken() for another family error = %v", err)
+	}
+	if _, err := o.RefreshTokens(ctx, other.RefreshToken, "", publicClientAuth); err != nil {
+		t.Errorf("RefreshTokens() for another family error = %v", err)
+	}
+}
+
+func TestRefreshTokensScope(t *testing.T) {
+	tests := []struct {
+		name      string
+		scope     string
+		wantScope string
+		wantErr   error
+	}{
+		{name: "original scope", scope: "", wantScope: "read write"},
+		{name: "same scope", scope: "read write", wantScope: "read write"},
+		{name: "narrower scope", scope: "read", wantScope: "read"},
+		{name: "wider scope", scope: "read admin", wantErr: ErrInvalidScope},
+		{name: "different scope", scope: "admin", wantErr: ErrInvalidScope},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, _ := newTestService(t)
+			ctx := context.Background()
+			tokens := issueTestTokens(t, o, "read write")
+
+			refreshed, err := o.RefreshTokens(ctx, tokens.RefreshToken, tt.scope, publicClientAuth)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("RefreshTokens() error = %v, want %v", err, tt.wantErr)
+				}
+				// A refused scope doesn't use up the refresh token
+				if _, err := o.RefreshTokens(ctx, tokens.RefreshToken, "", publicClientAuth); err != nil {
+					t.Errorf("RefreshTokens() after a refused scope error = %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RefreshTokens() error = %v", err)
+			}
+			if refreshed.Scope != tt.wantScope {
+				t.Errorf("RefreshTokens() scope = %q, want %q", refreshed.Scope, tt.wantScope)
+			}
+
+			// Narrowing applies to the access token only: the new refresh
+			// token can still be used for the full original scope
+			again, err := o.RefreshTokens(ctx, refreshed.RefreshToken, "", publicClientAuth)
+			if err != nil {
+				t.Fatalf("RefreshTokens() with the new token error = %v", err)
+			}
+			if again.Scope != "read write" {
+				t.Errorf("RefreshTokens() with the new token scope = %q, want %q", again.Scope, "read write")
+			}
+		})
+	}
+}
+
+func TestRefreshTokensWrongClient(t *testing.T) {
+	o, _ := newTestService(t)
+	tokens := issueTestTokens(t, o, "read")
+
+	clientAuth := &ClientAuth{ClientID: "service", ClientSecret: "secret", Method: "client_secret_basic"}
+	_, err := o.RefreshTokens(context.Background(), tokens.RefreshToken, "", clientAuth)
+	if !errors.Is(err, ErrInvalidGrant) {
+		t.Errorf("RefreshTokens() error = %v, want ErrInvalidGrant", err)
+	}
+}
@@ -0,0 +1,391 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/andyleap/passkey/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrRegistrationDisabled is returned when no initial access token is
+// configured for dynamic client registration
+var ErrRegistrationDisabled = errors.New("client registration is disabled")
+
+// RegistrationError is an RFC 7591 section 3.2.2 error response
+type RegistrationError struct {
+	Code        string
+	Description string
+}
+
+func (e *RegistrationError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+// ClientMetadata is the client metadata accepted at the registration
+// endpoint (RFC 7591 section 2)
+type ClientMetadata struct {
+	RedirectURIs            []string `json:"redirect_uris"`
+	ClientName              string   `json:"client_name,omitempty"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method,omitempty"`
+	GrantTypes              []string `json:"grant_types,omitempty"`
+	ResponseTypes           []string `json:"response_types,omitempty"`
+	Scope                   string   `json:"scope,omitempty"`
+	// PostLogoutRedirectURIs are allowed at the end session endpoint (OpenID
+	// Connect RP-Initiated Logout section 3.1)
+	PostLogoutRedirectURIs []string `json:"post_logout_redirect_uris,omitempty"`
+	// BackchannelLogoutURI must use https (OpenID Connect Back-Channel
+	// Logout section 2.2)
+	BackchannelLogoutURI string `json:"backchannel_logout_uri,omitempty"`
+	// ApplicationType is "web" (default) or "native" (OpenID Connect Dynamic
+	// Client Registration section 2). Native apps may use private-use
+	// redirect URI schemes and any loopback port.
+	ApplicationType string `json:"application_type,omitempty"`
+	// JWKS and JWKSURI hold the keys of a private_key_jwt client (RFC 7591
+	// section 2); only one may be set
+	JWKS    json.RawMessage `json:"jwks,omitempty"`
+	JWKSURI string          `json:"jwks_uri,omitempty"`
+	// RequirePushedAuthorizationRequests rejects authorization requests that
+	// weren't pushed to /oauth/par first (RFC 9126 section 6)
+	RequirePushedAuthorizationRequests bool `json:"require_pushed_authorization_requests,omitempty"`
+	// DPoPBoundAccessTokens rejects token requests without a DPoP proof
+	// (RFC 9449 section 5.2)
+	DPoPBoundAccessTokens bool `json:"dpop_bound_access_tokens,omitempty"`
+}
+
+// ClientRegistration is the client information response (RFC 7591 section
+// 3.2.1). The client secret and registration access token are only returned
+// when they are issued, as only their hashes are kept.
+type ClientRegistration struct {
+	ClientMetadata
+	ClientID                string `json:"client_id"`
+	ClientSecret            string `json:"client_secret,omitempty"`
+	ClientIDIssuedAt        int64  `json:"client_id_issued_at"`
+	ClientSecretExpiresAt   *int64 `json:"client_secret_expires_at,omitempty"`
+	RegistrationAccessToken string `json:"registration_access_token,omitempty"`
+	RegistrationClientURI   string `json:"registration_client_uri"`
+}
+
+// Application types accepted at the registration endpoint
+const (
+	ApplicationTypeWeb    = "web"
+	ApplicationTypeNative = "native"
+)
+
+// registrationGrantTypes are the grant_types a registered client may declare
+var registrationGrantTypes = []string{"authorization_code", "refresh_token"}
+
+// RegisterClient creates a client from the metadata a developer submitted
+// with the initial access token
+func (o *OAuthService) RegisterClient(ctx context.Context, initialAccessToken string, metadata *ClientMetadata) (*ClientRegistration, error) {
+	if o.options.RegistrationToken == "" {
+		return nil, ErrRegistrationDisabled
+	}
+	if subtle.ConstantTimeCompare([]byte(initialAccessToken), []byte(o.options.RegistrationToken)) != 1 {
+		return nil, ErrInvalidToken
+	}
+
+	client := &models.Client{
+		ID:        generateRandomCode(16),
+		CreatedAt: time.Now(),
+	}
+	if err := applyClientMetadata(client, metadata); err != nil {
+		return nil, err
+	}
+
+	registrationToken := generateRandomCode(32)
+	client.RegistrationAccessTokenHash = hashRegistrationToken(registrationToken)
+
+	clientSecret, err := issueClientSecret(client)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := o.clientStorage.SaveClient(ctx, client); err != nil {
+		return nil, fmt.Errorf("failed to save client: %w", err)
+	}
+
+	registration := o.clientRegistration(client)
+	registration.ClientSecret = clientSecret
+	registration.RegistrationAccessToken = registrationToken
+	return registration, nil
+}
+
+// GetClientRegistration returns a registered client's current metadata
+// (RFC 7592 section 2.1)
+func (o *OAuthService) GetClientRegistration(ctx context.Context, clientID, registrationToken string) (*ClientRegistration, error) {
+	client, err := o.registeredClient(ctx, clientID, registrationToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return o.clientRegistration(client), nil
+}
+
+// UpdateClientRegistration replaces a registered client's metadata (RFC 7592
+// section 2.2). A new secret is issued if the client becomes confidential.
+func (o *OAuthService) UpdateClientRegistration(ctx context.Context, clientID, registrationToken string, metadata *ClientMetadata) (*ClientRegistration, error) {
+	client, err := o.registeredClient(ctx, clientID, registrationToken)
+	if err != nil {
+		return nil, err
+	}
+
+	usedSecret := client.UsesClientSecret()
+	if err := applyClientMetadata(client, metadata); err != nil {
+		return nil, err
+	}
+
+	var clientSecret string
+	if !client.UsesClientSecret() {
+		client.ClientSecretHashes = nil
+	} else if !usedSecret {
+		clientSecret, err = issueClientSecret(client)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := o.clientStorage.SaveClient(ctx, client); err != nil {
+		return nil, fmt.Errorf("failed to save client: %w", err)
+	}
+
+	registration := o.clientRegistration(client)
+	registration.ClientSecret = clientSecret
+	return registration, nil
+}
+
+// DeleteClientRegistration deletes a registered client (RFC 7592 section 2.3)
+func (o *OAuthService) DeleteClientRegistration(ctx context.Context, clientID, registrationToken string) error {
+	if _, err := o.registeredClient(ctx, clientID, registrationToken); err != nil {
+		return err
+	}
+
+	if err := o.clientStorage.DeleteClient(ctx, clientID); err != nil {
+		return fmt.Errorf("failed to delete client: %w", err)
+	}
+
+	return nil
+}
+
+// registeredClient returns a dynamically registered client if the
+// registration access token matches. Unknown clients and clients from the
+// clients file get the same ErrInvalidToken (RFC 7592 section 3).
+func (o *OAuthService) registeredClient(ctx context.Context, clientID, registrationToken string) (*models.Client, error) {
+	client, err := o.clientStorage.GetClient(ctx, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client: %w", err)
+	}
+	if client == nil || client.RegistrationAccessTokenHash == "" {
+		return nil, ErrInvalidToken
+	}
+
+	hash := hashRegistrationToken(registrationToken)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(client.RegistrationAccessTokenHash)) != 1 {
+		return nil, ErrInvalidToken
+	}
+
+	return client, nil
+}
+
+func (o *OAuthService) clientRegistration(client *models.Client) *ClientRegistration {
+	registration := &ClientRegistration{
+		ClientMetadata: ClientMetadata{
+			RedirectURIs:            client.RedirectURIs,
+			PostLogoutRedirectURIs:  client.PostLogoutRedirectURIs,
+			BackchannelLogoutURI:    client.BackchannelLogoutURI,
+			ClientName:              client.Name,
+			TokenEndpointAuthMethod: client.TokenEndpointAuthMethod,
+			GrantTypes:              registrationGrantTypes,
+			ResponseTypes:           []string{"code"},
+			Scope:                   strings.Join(AllowedScopes(client), " "),
+			ApplicationType:         applicationType(client),
+			JWKSURI:                 client.JWKSURI,
+
+			RequirePushedAuthorizationRequests: client.RequirePAR,
+			DPoPBoundAccessTokens:              client.RequireDPoP,
+		},
+		ClientID:              client.ID,
+		ClientIDIssuedAt:      client.CreatedAt.Unix(),
+		RegistrationClientURI: o.options.Issuer + "/oauth/register/" + client.ID,
+	}
+	if client.JWKS != "" {
+		registration.JWKS = json.RawMessage(client.JWKS)
+	}
+	if client.UsesClientSecret() {
+		never := int64(0)
+		registration.ClientSecretExpiresAt = &never
+	}
+	return registration
+}
+
+func applicationType(client *models.Client) string {
+	if client.NativeApp {
+		return ApplicationTypeNative
+	}
+	return ApplicationTypeWeb
+}
+
+// applyClientMetadata validates submitted metadata and copies it onto the
+// client
+func applyClientMetadata(client *models.Client, metadata *ClientMetadata) error {
+	switch metadata.ApplicationType {
+	case "", ApplicationTypeWeb:
+		client.NativeApp = false
+	case ApplicationTypeNative:
+		client.NativeApp = true
+	default:
+		return &RegistrationError{Code: "invalid_client_metadata", Description: "application_type must be web or native"}
+	}
+
+	if len(metadata.RedirectURIs) == 0 {
+		return &RegistrationError{Code: "invalid_redirect_uri", Description: "at least one redirect_uri is required"}
+	}
+	for _, redirectURI := range metadata.RedirectURIs {
+		if err := validateRegisteredRedirectURI(client, redirectURI); err != nil {
+			return &RegistrationError{Code: "invalid_redirect_uri", Description: fmt.Sprintf("%s: %v", redirectURI, err)}
+		}
+	}
+
+	for _, redirectURI := range metadata.PostLogoutRedirectURIs {
+		if err := validateRegisteredRedirectURI(client, redirectURI); err != nil {
+			return &RegistrationError{Code: "invalid_client_metadata", Description: fmt.Sprintf("post_logout_redirect_uri %s: %v", redirectURI, err)}
+		}
+	}
+
+	if metadata.BackchannelLogoutURI != "" {
+		err := ValidateBackchannelLogoutURI(metadata.BackchannelLogoutURI)
+		if err == nil && !strings.HasPrefix(metadata.BackchannelLogoutURI, "https://") {
+			err = fmt.Errorf("must use https")
+		}
+		if err != nil {
+			return &RegistrationError{Code: "invalid_client_metadata", Description: fmt.Sprintf("backchannel_logout_uri: %v", err)}
+		}
+	}
+
+	authMethod := metadata.TokenEndpointAuthMethod
+	switch authMethod {
+	case "":
+		// RFC 7591 section 2: the default is client_secret_basic
+		authMethod = models.AuthMethodClientSecretBasic
+	case models.AuthMethodClientSecretBasic, models.AuthMethodClientSecretPost, models.AuthMethodNone:
+		if len(metadata.JWKS) > 0 || metadata.JWKSURI != "" {
+			return &RegistrationError{Code: "invalid_client_metadata", Description: "jwks and jwks_uri are only used with private_key_jwt"}
+		}
+	case models.AuthMethodPrivateKeyJWT:
+		if err := validateRegisteredKeys(metadata); err != nil {
+			return &RegistrationError{Code: "invalid_client_metadata", Description: err.Error()}
+		}
+	default:
+		return &RegistrationError{Code: "invalid_client_metadata", Description: "unsupported token_endpoint_auth_method"}
+	}
+
+	for _, grantType := range metadata.GrantTypes {
+		if !slices.Contains(registrationGrantTypes, grantType) {
+			return &RegistrationError{Code: "invalid_client_metadata", Description: fmt.Sprintf("unsupported grant_type %q", grantType)}
+		}
+	}
+	for _, responseType := range metadata.ResponseTypes {
+		if responseType != "code" {
+			return &RegistrationError{Code: "invalid_client_metadata", Description: fmt.Sprintf("unsupported response_type %q", responseType)}
+		}
+	}
+
+	// Other scopes are only granted to clients an administrator configured
+	var scopes []string
+	for _, scope := range strings.Fields(metadata.Scope) {
+		if !slices.Contains(DefaultAllowedScopes, scope) {
+			return &RegistrationError{Code: "invalid_client_metadata", Description: fmt.Sprintf("scope %q cannot be registered", scope)}
+		}
+		scopes = append(scopes, scope)
+	}
+
+	client.Name = metadata.ClientName
+	if client.Name == "" {
+		client.Name = client.ID
+	}
+	client.RedirectURIs = metadata.RedirectURIs
+	client.PostLogoutRedirectURIs = metadata.PostLogoutRedirectURIs
+	client.BackchannelLogoutURI = metadata.BackchannelLogoutURI
+	client.TokenEndpointAuthMethod = authMethod
+	client.AllowedScopes = scopes
+	client.RequirePAR = metadata.RequirePushedAuthorizationRequests
+	client.RequireDPoP = metadata.DPoPBoundAccessTokens
+	client.JWKS = string(metadata.JWKS)
+	client.JWKSURI = metadata.JWKSURI
+	// Public clients can't keep a secret, so they must use PKCE
+	client.RequirePKCE = authMethod == models.AuthMethodNone
+	client.AccessTokenFormat = models.AccessTokenFormatOpaque
+	client.ResponseMode = models.ResponseModeQuery
+
+	return nil
+}
+
+// validateRegisteredRedirectURI also limits http URIs to the loopback
+// interface for development
+func validateRegisteredRedirectURI(client *models.Client, redirectURI string) error {
+	if err := ValidateRedirectURI(client, redirectURI); err != nil {
+		return err
+	}
+
+	u, _ := url.Parse(redirectURI)
+	if u.Scheme != "http" || IsLocalhostRedirectURI(redirectURI) || isLoopbackIP(u.Hostname()) {
+		return nil
+	}
+	return fmt.Errorf("http is only allowed for loopback addresses")
+}
+
+// validateRegisteredKeys checks the key set of a private_key_jwt client.
+// Registered key sets must be fetched over https.
+func validateRegisteredKeys(metadata *ClientMetadata) error {
+	switch {
+	case len(metadata.JWKS) > 0 && metadata.JWKSURI != "":
+		return fmt.Errorf("jwks and jwks_uri must not both be set")
+	case len(metadata.JWKS) > 0:
+		if err := ValidateClientJWKS(string(metadata.JWKS)); err != nil {
+			return fmt.Errorf("jwks: %v", err)
+		}
+	case metadata.JWKSURI != "":
+		err := ValidateJWKSURI(metadata.JWKSURI)
+		if err == nil && !strings.HasPrefix(metadata.JWKSURI, "https://") {
+			err = fmt.Errorf("must use https")
+		}
+		if err != nil {
+			return fmt.Errorf("jwks_uri: %v", err)
+		}
+	default:
+		return fmt.Errorf("private_key_jwt requires jwks or jwks_uri")
+	}
+
+	return nil
+}
+
+// issueClientSecret generates a secret for a client that authenticates with
+// one and stores its hash, returning the secret to show the developer once
+func issueClientSecret(client *models.Client) (string, error) {
+	if !client.UsesClientSecret() {
+		return "", nil
+	}
+
+	secret := generateRandomCode(32)
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash client secret: %w", err)
+	}
+	client.ClientSecretHashes = []string{string(hash)}
+
+	return secret, nil
+}
+
+func hashRegistrationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,71 @@
+package oauth
+
+import (
+	"net/url"
+
+	"github.com/andyleap/passkey/internal/models"
+)
+
+// ResolveResponseMode returns how the authorization response should be sent
+// back to the client: the requested response_mode, or the client's default
+func ResolveResponseMode(client *models.Client, requested string) (string, error) {
+	if requested == "" {
+		if client.ResponseMode == "" {
+			return models.ResponseModeQuery, nil
+		}
+		return client.ResponseMode, nil
+	}
+
+	switch requested {
+	case models.ResponseModeQuery, models.ResponseModeFragment, models.ResponseModeFormPost:
+		return requested, nil
+	default:
+		return "", &AuthorizationError{Code: "invalid_request", Description: "unsupported response_mode"}
+	}
+}
+
+// CodeResponseParams returns the parameters of a successful authorization response
+func CodeResponseParams(code, state string) url.Values {
+	params := url.Values{}
+	params.Set("code", code)
+	if state != "" {
+		params.Set("state", state)
+	}
+	return params
+}
+
+// ErrorResponseParams returns the parameters of an authorization error response
+func ErrorResponseParams(errorCode, errorDescription, state string) url.Values {
+	params := url.Values{}
+	params.Set("error", errorCode)
+	if errorDescription != "" {
+		params.Set("error_description", errorDescription)
+	}
+	if state != "" {
+		params.Set("state", state)
+	}
+	return params
+}
+
+// BuildResponseURL adds the authorization response parameters to the redirect
+// URI, in the query string or, for the fragment response mode, the fragment.
+// form_post responses are rendered as a form by the UI instead.
+func (o *OAuthService) BuildResponseURL(redirectURI, responseMode string, params url.Values) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI // fallback
+	}
+
+	if responseMode == models.ResponseModeFragment {
+		u.Fragment = ""
+		return u.String() + "#" + params.Encode()
+	}
+
+	q := u.Query()
+	for key, values := range params {
+		q[key] = values
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
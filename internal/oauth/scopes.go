@@ -0,0 +1,50 @@
+package oauth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/andyleap/passkey/internal/models"
+)
+
+// DefaultAllowedScopes apply to clients that don't declare allowed_scopes
+var DefaultAllowedScopes = []string{ScopeOpenID, ScopeProfile}
+
+// scopeDescriptions are shown on the consent page for well-known scopes
+var scopeDescriptions = map[string]string{
+	ScopeOpenID:  "Confirm your identity",
+	ScopeProfile: "See your username and display name",
+}
+
+// AllowedScopes returns the scopes a client may request
+func AllowedScopes(client *models.Client) []string {
+	if len(client.AllowedScopes) == 0 {
+		return DefaultAllowedScopes
+	}
+	return client.AllowedScopes
+}
+
+// ScopeDescription returns a human readable description of a scope, or the
+// scope itself for scopes the service doesn't know
+func ScopeDescription(scope string) string {
+	if description, ok := scopeDescriptions[scope]; ok {
+		return description
+	}
+	return scope
+}
+
+// validateScope checks a requested scope against the client's allowed scopes
+// and returns it normalized
+func validateScope(client *models.Client, scope string) (string, error) {
+	allowed := AllowedScopes(client)
+
+	scopes := strings.Fields(scope)
+	for _, s := range scopes {
+		if !slices.Contains(allowed, s) {
+			return "", &AuthorizationError{Code: "invalid_scope", Description: fmt.Sprintf("scope %q is not allowed for this client", s)}
+		}
+	}
+
+	return strings.Join(scopes, " "), nil
+}
@@ -0,0 +1,363 @@
+package oauth
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/andyleap/passkey/internal/keys"
+	"github.com/andyleap/passkey/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	defaultAccessTokenLifetime  = time.Hour
+	defaultRefreshTokenLifetime = 30 * 24 * time.Hour
+	idTokenLifetime             = time.Hour
+)
+
+// accessTokenType is the JWT "typ" header of JWT access tokens (RFC 9068)
+const accessTokenType = "at+jwt"
+
+// Scopes with special meaning to the service
+const (
+	// ScopeOpenID requests an OpenID Connect ID token
+	ScopeOpenID = "openid"
+	// ScopeProfile grants access to the user's name claims
+	ScopeProfile = "profile"
+)
+
+var (
+	// ErrInvalidToken is returned for unknown, expired or revoked access tokens
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrInvalidGrant is returned when an authorization code or refresh token
+	// is unknown, expired, revoked, replayed or was issued to another client
+	ErrInvalidGrant = errors.New("invalid grant")
+	// ErrInvalidScope is returned when a token request asks for scopes beyond
+	// what was granted
+	ErrInvalidScope = errors.New("invalid scope")
+)
+
+// passkeyAMR are the authentication method references (RFC 8176) for a
+// user-verified passkey ceremony
+var passkeyAMR = []string{"hwk", "user"}
+
+// TokenResponse is the successful response of the token endpoint
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+// tokenGrant is what a set of tokens is issued for, whether it came from an
+// authorization code or a refresh token
+type tokenGrant struct {
+	FamilyID string
+	ClientID string
+	Username string
+	UserID   []byte
+	Scope    string
+	AuthTime time.Time
+	Nonce    string
+	// SessionID is the session the user authorized the client in, if any
+	SessionID string
+	// AccessScope narrows the access token's scope on refresh; the refresh
+	// token keeps the full Scope (RFC 6749 section 6)
+	AccessScope string
+	// GrantType is models.GrantTypeClientCredentials for client tokens, which
+	// get neither a refresh token nor an ID token
+	GrantType string
+	// DPoPJKT is the thumbprint of the DPoP key the tokens are bound to
+	DPoPJKT string
+}
+
+// IssueTokens issues an access token and a refresh token for a redeemed
+// authorization code, and an ID token when the openid scope was granted. With
+// a dpopJKT the tokens are bound to the client's DPoP key.
+func (o *OAuthService) IssueTokens(ctx context.Context, authCode *models.AuthorizationCode, dpopJKT string) (*TokenResponse, error) {
+	return o.issueTokens(ctx, &tokenGrant{
+		FamilyID:  generateRandomCode(16),
+		ClientID:  authCode.ClientID,
+		Username:  authCode.Username,
+		UserID:    authCode.UserID,
+		Scope:     authCode.Scope,
+		AuthTime:  authCode.AuthTime,
+		Nonce:     authCode.Nonce,
+		SessionID: authCode.SessionID,
+		DPoPJKT:   dpopJKT,
+	})
+}
+
+func (o *OAuthService) issueTokens(ctx context.Context, grant *tokenGrant) (*TokenResponse, error) {
+	now := time.Now()
+
+	scope := grant.Scope
+	if grant.AccessScope != "" {
+		scope = grant.AccessScope
+	}
+
+	accessToken := &models.AccessToken{
+		Token:     generateRandomCode(32),
+		FamilyID:  grant.FamilyID,
+		ClientID:  grant.ClientID,
+		Username:  grant.Username,
+		UserID:    grant.UserID,
+		Scope:     scope,
+		GrantType: grant.GrantType,
+		DPoPJKT:   grant.DPoPJKT,
+		CreatedAt: now,
+		ExpiresAt: now.Add(o.options.AccessTokenLifetime),
+	}
+
+	if err := o.sessionStorage.SaveAccessToken(ctx, accessToken); err != nil {
+		return nil, fmt.Errorf("failed to save access token: %w", err)
+	}
+
+	// JWT access tokens are still recorded by their jti so they can be revoked
+	token := accessToken.Token
+	client, ok := o.GetClient(ctx, grant.ClientID)
+	if ok && client.AccessTokenFormat == models.AccessTokenFormatJWT {
+		signed, err := o.signAccessToken(accessToken, grant.AuthTime)
+		if err != nil {
+			return nil, err
+		}
+		token = signed
+	}
+
+	response := &TokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(o.options.AccessTokenLifetime.Seconds()),
+		Scope:       scope,
+	}
+	if accessToken.DPoPJKT != "" {
+		response.TokenType = DPoPTokenType
+	}
+
+	// A client can simply request another token for itself (RFC 6749
+	// section 4.4.3)
+	if accessToken.IsClientToken() {
+		return response, nil
+	}
+
+	refreshToken := &models.RefreshToken{
+		Token:     generateRandomCode(32),
+		FamilyID:  grant.FamilyID,
+		ClientID:  grant.ClientID,
+		Username:  grant.Username,
+		UserID:    grant.UserID,
+		Scope:     grant.Scope,
+		SessionID: grant.SessionID,
+		AuthTime:  grant.AuthTime,
+		CreatedAt: now,
+		ExpiresAt: now.Add(o.options.RefreshTokenLifetime),
+	}
+
+	// Confidential clients' refresh tokens are already bound to their
+	// credentials (RFC 9449 section 5)
+	if ok && !client.IsConfidential() {
+		refreshToken.DPoPJKT = grant.DPoPJKT
+	}
+
+	if err := o.sessionStorage.SaveRefreshToken(ctx, refreshToken); err != nil {
+		return nil, fmt.Errorf("failed to save refresh token: %w", err)
+	}
+	response.RefreshToken = refreshToken.Token
+
+	if err := o.recordSessionClient(ctx, grant); err != nil {
+		return nil, err
+	}
+
+	if HasScope(scope, ScopeOpenID) {
+		idToken, err := o.signIDToken(grant, now)
+		if err != nil {
+			return nil, err
+		}
+		response.IDToken = idToken
+	}
+
+	return response, nil
+}
+
+// signIDToken builds and signs an OpenID Connect ID token
+func (o *OAuthService) signIDToken(grant *tokenGrant, now time.Time) (string, error) {
+	claims := jwt.MapClaims{
+		"iss":       o.options.Issuer,
+		"sub":       Subject(grant.UserID),
+		"aud":       grant.ClientID,
+		"exp":       now.Add(idTokenLifetime).Unix(),
+		"iat":       now.Unix(),
+		"auth_time": grant.AuthTime.Unix(),
+		"amr":       passkeyAMR,
+	}
+	if grant.Nonce != "" {
+		claims["nonce"] = grant.Nonce
+	}
+	if grant.SessionID != "" {
+		claims["sid"] = SessionSID(grant.SessionID)
+	}
+
+	return o.keyManager.Sign(claims)
+}
+
+// signAccessToken builds and signs a JWT access token (RFC 9068). The
+// audience is the service itself, which serves the userinfo endpoint.
+func (o *OAuthService) signAccessToken(accessToken *models.AccessToken, authTime time.Time) (string, error) {
+	claims := jwt.MapClaims{
+		"iss":       o.options.Issuer,
+		"sub":       AccessTokenSubject(accessToken),
+		"aud":       o.options.Issuer,
+		"client_id": accessToken.ClientID,
+		"exp":       accessToken.ExpiresAt.Unix(),
+		"iat":       accessToken.CreatedAt.Unix(),
+		"jti":       accessToken.Token,
+	}
+	if !accessToken.IsClientToken() {
+		claims["auth_time"] = authTime.Unix()
+	}
+	if accessToken.Scope != "" {
+		claims["scope"] = accessToken.Scope
+	}
+	if accessToken.DPoPJKT != "" {
+		// RFC 9449 section 6.1
+		claims["cnf"] = map[string]string{"jkt": accessToken.DPoPJKT}
+	}
+
+	return o.keyManager.SignWithType(claims, accessTokenType)
+}
+
+// ValidateAccessToken looks up an access token presented by a resource client.
+// JWT access tokens must carry a valid signature and refer to a live record.
+func (o *OAuthService) ValidateAccessToken(ctx context.Context, token string) (*models.AccessToken, error) {
+	if strings.Count(token, ".") == 2 {
+		jti, err := o.parseAccessToken(token)
+		if err != nil {
+			return nil, ErrInvalidToken
+		}
+		token = jti
+	}
+
+	accessToken, err := o.sessionStorage.GetAccessToken(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get access token: %w", err)
+	}
+	if accessToken == nil || time.Now().After(accessToken.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+
+	revoked, err := o.tokenRevoked(ctx, accessToken.FamilyID, accessToken.Username, accessToken.ClientID, accessToken.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrInvalidToken
+	}
+
+	return accessToken, nil
+}
+
+// tokenRevoked reports whether a token's family has been revoked, or the user
+// revoked the client's access after the token was issued
+func (o *OAuthService) tokenRevoked(ctx context.Context, familyID, username, clientID string, issuedAt time.Time) (bool, error) {
+	if familyID != "" {
+		revoked, err := o.sessionStorage.IsTokenFamilyRevoked(ctx, familyID)
+		if err != nil {
+			return false, fmt.Errorf("failed to check token family: %w", err)
+		}
+		if revoked {
+			return true, nil
+		}
+	}
+
+	revokedAt, err := o.sessionStorage.GetClientTokensRevokedAt(ctx, username, clientID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check client revocation: %w", err)
+	}
+
+	return !revokedAt.IsZero() && !issuedAt.After(revokedAt), nil
+}
+
+// parseAccessToken verifies a JWT access token and returns its jti
+func (o *OAuthService) parseAccessToken(token string) (string, error) {
+	parsed, err := jwt.Parse(token, o.keyManager.Keyfunc,
+		jwt.WithIssuer(o.options.Issuer),
+		jwt.WithAudience(o.options.Issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return "", err
+	}
+	if typ, _ := parsed.Header["typ"].(string); typ != accessTokenType {
+		return "", fmt.Errorf("unexpected token type %q", typ)
+	}
+
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", fmt.Errorf("unexpected claims")
+	}
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return "", fmt.Errorf("missing jti")
+	}
+
+	return jti, nil
+}
+
+// UserInfoClaims returns the claims about the user that the granted scopes
+// allow the client to see
+func UserInfoClaims(user *models.User, scope string) map[string]any {
+	claims := map[string]any{
+		"sub": Subject(user.ID),
+	}
+
+	if HasScope(scope, ScopeProfile) {
+		claims["preferred_username"] = user.Name
+		name := user.DisplayName
+		if name == "" {
+			name = user.Name
+		}
+		claims["name"] = name
+	}
+
+	return claims
+}
+
+// JWKS returns the public keys relying parties use to verify ID tokens
+func (o *OAuthService) JWKS() keys.JWKS {
+	return o.keyManager.JWKS()
+}
+
+// Subject returns the stable "sub" claim for a user ID
+func Subject(userID []byte) string {
+	return base64.RawURLEncoding.EncodeToString(userID)
+}
+
+// AccessTokenSubject returns the "sub" of an access token: the user, or the
+// client ID for client credentials tokens
+func AccessTokenSubject(accessToken *models.AccessToken) string {
+	if accessToken.IsClientToken() {
+		return accessToken.ClientID
+	}
+	return Subject(accessToken.UserID)
+}
+
+// HasScope reports whether a space-delimited scope string contains scope
+func HasScope(scopes, scope string) bool {
+	for _, s := range strings.Fields(scopes) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeScope collapses whitespace in a scope parameter
+func normalizeScope(scope string) string {
+	return strings.Join(strings.Fields(scope), " ")
+}
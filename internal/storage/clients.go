@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/andyleap/passkey/internal/models"
+)
+
+// ErrClientReadOnly is returned when saving or deleting a client that is
+// managed by the clients file
+var ErrClientReadOnly = errors.New("client is managed by configuration")
+
+// MemoryClientStorage keeps clients in memory; they are lost on restart
+type MemoryClientStorage struct {
+	clients map[string]*models.Client
+	mu      sync.RWMutex
+}
+
+func NewMemoryClientStorage() *MemoryClientStorage {
+	return &MemoryClientStorage{
+		clients: make(map[string]*models.Client),
+	}
+}
+
+func (m *MemoryClientStorage) GetClient(ctx context.Context, clientID string) (*models.Client, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	client, exists := m.clients[clientID]
+	if !exists {
+		return nil, nil
+	}
+	return copyClient(client), nil
+}
+
+func (m *MemoryClientStorage) SaveClient(ctx context.Context, client *models.Client) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.clients[client.ID] = copyClient(client)
+	return nil
+}
+
+func (m *MemoryClientStorage) DeleteClient(ctx context.Context, clientID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.clients, clientID)
+	return nil
+}
+
+// ConfigClientStorage serves the clients from the clients file ahead of a
+// writable store holding clients registered at runtime. Configured clients
+// are read-only; change them by editing the file.
+type ConfigClientStorage struct {
+	clients  map[string]*models.Client
+	registry ClientStorage
+	mu       sync.RWMutex
+}
+
+// NewConfigClientStorage layers the configured clients over registry, which
+// may be nil if clients can't be registered at runtime
+func NewConfigClientStorage(clients map[string]*models.Client, registry ClientStorage) *ConfigClientStorage {
+	storage := &ConfigClientStorage{
+		registry: registry,
+	}
+	storage.SetClients(clients)
+
+	return storage
+}
+
+// SetClients atomically replaces the configured clients, such as after the
+// clients file changed. The clients are copied. Those without a created_at
+// keep the time they were first loaded.
+func (c *ConfigClientStorage) SetClients(clients map[string]*models.Client) {
+	loadedAt := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	configured := make(map[string]*models.Client, len(clients))
+	for id, client := range clients {
+		client = copyClient(client)
+		if client.CreatedAt.IsZero() {
+			client.CreatedAt = loadedAt
+			if previous, exists := c.clients[id]; exists {
+				client.CreatedAt = previous.CreatedAt
+			}
+		}
+		configured[id] = client
+	}
+	c.clients = configured
+}
+
+func (c *ConfigClientStorage) GetClient(ctx context.Context, clientID string) (*models.Client, error) {
+	if client := c.configuredClient(clientID); client != nil {
+		return client, nil
+	}
+	if c.registry == nil {
+		return nil, nil
+	}
+	return c.registry.GetClient(ctx, clientID)
+}
+
+func (c *ConfigClientStorage) SaveClient(ctx context.Context, client *models.Client) error {
+	if c.configuredClient(client.ID) != nil {
+		return fmt.Errorf("%w: %s", ErrClientReadOnly, client.ID)
+	}
+	if c.registry == nil {
+		return fmt.Errorf("%w: %s", ErrClientReadOnly, client.ID)
+	}
+	return c.registry.SaveClient(ctx, client)
+}
+
+func (c *ConfigClientStorage) DeleteClient(ctx context.Context, clientID string) error {
+	if c.configuredClient(clientID) != nil {
+		return fmt.Errorf("%w: %s", ErrClientReadOnly, clientID)
+	}
+	if c.registry == nil {
+		return nil
+	}
+	return c.registry.DeleteClient(ctx, clientID)
+}
+
+// configuredClient returns a copy of a client from the clients file, or nil
+func (c *ConfigClientStorage) configuredClient(clientID string) *models.Client {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	client, exists := c.clients[clientID]
+	if !exists {
+		return nil
+	}
+	return copyClient(client)
+}
+
+// copyClient returns a copy of a client that shares nothing with the original
+func copyClient(client *models.Client) *models.Client {
+	clientCopy := *client
+	clientCopy.RedirectURIs = append([]string(nil), client.RedirectURIs...)
+	clientCopy.PostLogoutRedirectURIs = append([]string(nil), client.PostLogoutRedirectURIs...)
+	clientCopy.ClientSecretHashes = append([]string(nil), client.ClientSecretHashes...)
+	clientCopy.AllowedScopes = append([]string(nil), client.AllowedScopes...)
+	return &clientCopy
+}
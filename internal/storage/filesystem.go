@@ -27,6 +27,24 @@ func NewFilesystemStorage(basePath string) (*FilesystemStorage, error) {
 		return nil, fmt.Errorf("failed to create users path: %w", err)
 	}
 
+	// Create keys subdirectory; signing keys are readable only by the service
+	keysPath := filepath.Join(basePath, "keys")
+	if err := os.MkdirAll(keysPath, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create keys path: %w", err)
+	}
+
+	// Create grants subdirectory, with a directory of consent grants per user
+	grantsPath := filepath.Join(basePath, "grants")
+	if err := os.MkdirAll(grantsPath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create grants path: %w", err)
+	}
+
+	// Create clients subdirectory; clients hold secret hashes
+	clientsPath := filepath.Join(basePath, "clients")
+	if err := os.MkdirAll(clientsPath, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create clients path: %w", err)
+	}
+
 	return &FilesystemStorage{
 		basePath: basePath,
 	}, nil
@@ -115,3 +133,212 @@ func (f *FilesystemStorage) UserExists(ctx context.Context, username string) (bo
 
 	return true, nil
 }
+
+func (f *FilesystemStorage) GetKeySet(ctx context.Context) (*models.KeySet, error) {
+	keySetPath := filepath.Join(f.basePath, "keys", "keyset.json")
+
+	data, err := os.ReadFile(keySetPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read key set file: %w", err)
+	}
+
+	var keySet models.KeySet
+	if err := json.Unmarshal(data, &keySet); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal key set: %w", err)
+	}
+
+	return &keySet, nil
+}
+
+func (f *FilesystemStorage) SaveKeySet(ctx context.Context, keySet *models.KeySet) error {
+	keySetPath := filepath.Join(f.basePath, "keys", "keyset.json")
+
+	data, err := json.MarshalIndent(keySet, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal key set: %w", err)
+	}
+
+	// Write to a temporary file and rename so readers never see a partial key set
+	tmpPath := keySetPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write key set file: %w", err)
+	}
+	if err := os.Rename(tmpPath, keySetPath); err != nil {
+		return fmt.Errorf("failed to replace key set file: %w", err)
+	}
+
+	return nil
+}
+
+func (f *FilesystemStorage) GetClient(ctx context.Context, clientID string) (*models.Client, error) {
+	clientPath, err := f.clientPath(clientID)
+	if err != nil {
+		// No client could have been saved under this ID
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(clientPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read client file: %w", err)
+	}
+
+	var client models.Client
+	if err := json.Unmarshal(data, &client); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal client: %w", err)
+	}
+
+	return &client, nil
+}
+
+func (f *FilesystemStorage) SaveClient(ctx context.Context, client *models.Client) error {
+	clientPath, err := f.clientPath(client.ID)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(client, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal client: %w", err)
+	}
+
+	if err := os.WriteFile(clientPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write client file: %w", err)
+	}
+
+	return nil
+}
+
+func (f *FilesystemStorage) DeleteClient(ctx context.Context, clientID string) error {
+	clientPath, err := f.clientPath(clientID)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(clientPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete client file: %w", err)
+	}
+
+	return nil
+}
+
+// clientPath returns the file of a client, rejecting IDs that would escape
+// the clients directory
+func (f *FilesystemStorage) clientPath(clientID string) (string, error) {
+	if clientID == "" || strings.ContainsAny(clientID, `/\`) || strings.Contains(clientID, "..") {
+		return "", fmt.Errorf("invalid client ID")
+	}
+	return filepath.Join(f.basePath, "clients", clientID+".json"), nil
+}
+
+func (f *FilesystemStorage) GetConsentGrant(ctx context.Context, username, clientID string) (*models.ConsentGrant, error) {
+	grantPath, err := f.grantPath(username, clientID)
+	if err != nil {
+		// No grant could have been saved under this ID
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(grantPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read consent grant file: %w", err)
+	}
+
+	var grant models.ConsentGrant
+	if err := json.Unmarshal(data, &grant); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal consent grant: %w", err)
+	}
+
+	return &grant, nil
+}
+
+func (f *FilesystemStorage) GetConsentGrants(ctx context.Context, username string) ([]*models.ConsentGrant, error) {
+	files, err := os.ReadDir(filepath.Join(f.basePath, "grants", username))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read grants directory: %w", err)
+	}
+
+	var grants []*models.ConsentGrant
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(f.basePath, "grants", username, file.Name()))
+		if err != nil {
+			continue // Skip problematic files
+		}
+
+		var grant models.ConsentGrant
+		if err := json.Unmarshal(data, &grant); err != nil {
+			continue // Skip malformed files
+		}
+		grants = append(grants, &grant)
+	}
+
+	return grants, nil
+}
+
+func (f *FilesystemStorage) SaveConsentGrant(ctx context.Context, username string, grant *models.ConsentGrant) error {
+	grantPath, err := f.grantPath(username, grant.ClientID)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(grantPath), 0755); err != nil {
+		return fmt.Errorf("failed to create user grants path: %w", err)
+	}
+
+	data, err := json.MarshalIndent(grant, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal consent grant: %w", err)
+	}
+
+	// Write to a temporary file and rename so readers never see a partial grant
+	tmpPath := grantPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write consent grant file: %w", err)
+	}
+	if err := os.Rename(tmpPath, grantPath); err != nil {
+		return fmt.Errorf("failed to replace consent grant file: %w", err)
+	}
+
+	return nil
+}
+
+func (f *FilesystemStorage) DeleteConsentGrant(ctx context.Context, username, clientID string) (bool, error) {
+	grantPath, err := f.grantPath(username, clientID)
+	if err != nil {
+		return false, nil
+	}
+
+	if err := os.Remove(grantPath); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to delete consent grant file: %w", err)
+	}
+
+	return true, nil
+}
+
+// grantPath returns the file of a user's consent grant for a client,
+// rejecting names that would escape the grants directory
+func (f *FilesystemStorage) grantPath(username, clientID string) (string, error) {
+	for _, name := range []string{username, clientID} {
+		if name == "" || strings.ContainsAny(name, `/\`) || strings.Contains(name, "..") {
+			return "", fmt.Errorf("invalid consent grant name")
+		}
+	}
+	return filepath.Join(f.basePath, "grants", username, clientID+".json"), nil
+}
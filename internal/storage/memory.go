@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"slices"
 	"sync"
 	"time"
 
@@ -11,13 +12,69 @@ import (
 type MemoryStorage struct {
 	webauthnSessions map[string]*models.WebAuthnSession
 	sessions         map[string]*models.Session
+	sessionClients   map[string][]string
+	// backchannelQueue and backchannelLog hold back-channel logout
+	// deliveries and the attempts made at them
+	backchannelQueue map[string]*queuedBackchannelLogout
+	backchannelLog   map[string][]*models.BackchannelLogoutAttempt
+	authRequests     map[string]*models.AuthorizationRequest
+	pushedRequests   map[string]*models.PushedAuthorizationRequest
+	usedAssertions   map[string]time.Time
+	usedDPoPProofs   map[string]time.Time
+	dpopNonces       map[string]time.Time
+	authCodes        map[string]*models.AuthorizationCode
+	deviceAuths      map[string]*models.DeviceAuthorization
+	deviceUserCodes  map[string]string
+	devicePolls      map[string]time.Time
+	userCodeFailures map[string]*failureCount
+	accessTokens     map[string]*models.AccessToken
+	refreshTokens    map[string]*models.RefreshToken
+	usedRefresh      map[string]bool
+	revokedFamilies  map[string]time.Time
+	revokedClients   map[string]clientRevocation
 	mu               sync.RWMutex
 }
 
+// failureCount counts failures until the end of their window
+type failureCount struct {
+	Count     int
+	ExpiresAt time.Time
+}
+
+// queuedBackchannelLogout is a queued delivery and until when it is claimed
+type queuedBackchannelLogout struct {
+	Delivery     models.BackchannelLogoutDelivery
+	ClaimedUntil time.Time
+}
+
+// clientRevocation records when a user revoked a client's access
+type clientRevocation struct {
+	RevokedAt time.Time
+	ExpiresAt time.Time
+}
+
 func NewMemoryStorage() *MemoryStorage {
 	storage := &MemoryStorage{
 		webauthnSessions: make(map[string]*models.WebAuthnSession),
 		sessions:         make(map[string]*models.Session),
+		sessionClients:   make(map[string][]string),
+		backchannelQueue: make(map[string]*queuedBackchannelLogout),
+		backchannelLog:   make(map[string][]*models.BackchannelLogoutAttempt),
+		authRequests:     make(map[string]*models.AuthorizationRequest),
+		pushedRequests:   make(map[string]*models.PushedAuthorizationRequest),
+		usedAssertions:   make(map[string]time.Time),
+		usedDPoPProofs:   make(map[string]time.Time),
+		dpopNonces:       make(map[string]time.Time),
+		authCodes:        make(map[string]*models.AuthorizationCode),
+		deviceAuths:      make(map[string]*models.DeviceAuthorization),
+		deviceUserCodes:  make(map[string]string),
+		devicePolls:      make(map[string]time.Time),
+		userCodeFailures: make(map[string]*failureCount),
+		accessTokens:     make(map[string]*models.AccessToken),
+		refreshTokens:    make(map[string]*models.RefreshToken),
+		usedRefresh:      make(map[string]bool),
+		revokedFamilies:  make(map[string]time.Time),
+		revokedClients:   make(map[string]clientRevocation),
 	}
 
 	// Start background cleanup routine
@@ -88,12 +145,15 @@ func (m *MemoryStorage) GetSession(ctx context.Context, sessionID string) (*mode
 		m.mu.RUnlock()
 		m.mu.Lock()
 		delete(m.sessions, sessionID)
+		delete(m.sessionClients, sessionID)
 		m.mu.Unlock()
 		m.mu.RLock()
 		return nil, nil
 	}
 
-	return session, nil
+	sessionCopy := *session
+	sessionCopy.ClientIDs = append([]string(nil), m.sessionClients[sessionID]...)
+	return &sessionCopy, nil
 }
 
 func (m *MemoryStorage) DeleteSession(ctx context.Context, sessionID string) error {
@@ -101,9 +161,78 @@ func (m *MemoryStorage) DeleteSession(ctx context.Context, sessionID string) err
 	defer m.mu.Unlock()
 
 	delete(m.sessions, sessionID)
+	delete(m.sessionClients, sessionID)
+	return nil
+}
+
+func (m *MemoryStorage) AddSessionClient(ctx context.Context, sessionID, clientID string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !slices.Contains(m.sessionClients[sessionID], clientID) {
+		m.sessionClients[sessionID] = append(m.sessionClients[sessionID], clientID)
+	}
+	return nil
+}
+
+func (m *MemoryStorage) QueueBackchannelLogout(ctx context.Context, delivery *models.BackchannelLogoutDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.backchannelQueue[delivery.ID] = &queuedBackchannelLogout{Delivery: *delivery}
+	return nil
+}
+
+func (m *MemoryStorage) ClaimBackchannelLogouts(ctx context.Context, now time.Time, lease time.Duration) ([]*models.BackchannelLogoutDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var claimed []*models.BackchannelLogoutDelivery
+	for _, queued := range m.backchannelQueue {
+		if queued.Delivery.NextAttemptAt.After(now) || queued.ClaimedUntil.After(now) {
+			continue
+		}
+		queued.ClaimedUntil = now.Add(lease)
+		delivery := queued.Delivery
+		claimed = append(claimed, &delivery)
+	}
+
+	return claimed, nil
+}
+
+func (m *MemoryStorage) CompleteBackchannelLogout(ctx context.Context, deliveryID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.backchannelQueue, deliveryID)
+	return nil
+}
+
+func (m *MemoryStorage) RecordBackchannelLogoutAttempt(ctx context.Context, attempt *models.BackchannelLogoutAttempt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attemptCopy := *attempt
+	log := append([]*models.BackchannelLogoutAttempt{&attemptCopy}, m.backchannelLog[attempt.ClientID]...)
+	if len(log) > backchannelLogoutLogSize {
+		log = log[:backchannelLogoutLogSize]
+	}
+	m.backchannelLog[attempt.ClientID] = log
 	return nil
 }
 
+func (m *MemoryStorage) GetBackchannelLogoutAttempts(ctx context.Context, clientID string) ([]*models.BackchannelLogoutAttempt, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	attempts := make([]*models.BackchannelLogoutAttempt, 0, len(m.backchannelLog[clientID]))
+	for _, attempt := range m.backchannelLog[clientID] {
+		attemptCopy := *attempt
+		attempts = append(attempts, &attemptCopy)
+	}
+	return attempts, nil
+}
+
 func (m *MemoryStorage) GetUserSessions(ctx context.Context, username string) ([]*models.Session, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -120,6 +249,329 @@ func (m *MemoryStorage) GetUserSessions(ctx context.Context, username string) ([
 	return userSessions, nil
 }
 
+func (m *MemoryStorage) SaveAuthorizationRequest(ctx context.Context, request *models.AuthorizationRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.authRequests[request.ID] = request
+	return nil
+}
+
+func (m *MemoryStorage) GetAuthorizationRequest(ctx context.Context, requestID string) (*models.AuthorizationRequest, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	request, exists := m.authRequests[requestID]
+	if !exists || time.Now().After(request.ExpiresAt) {
+		return nil, nil
+	}
+
+	return request, nil
+}
+
+func (m *MemoryStorage) ConsumeAuthorizationRequest(ctx context.Context, requestID string) (*models.AuthorizationRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	request, exists := m.authRequests[requestID]
+	if !exists {
+		return nil, nil
+	}
+	delete(m.authRequests, requestID)
+
+	if time.Now().After(request.ExpiresAt) {
+		return nil, nil
+	}
+
+	return request, nil
+}
+
+func (m *MemoryStorage) SaveAuthorizationCode(ctx context.Context, code *models.AuthorizationCode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.authCodes[code.Code] = code
+	return nil
+}
+
+func (m *MemoryStorage) SavePushedAuthorizationRequest(ctx context.Context, request *models.PushedAuthorizationRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pushedRequests[request.RequestURI] = request
+	return nil
+}
+
+func (m *MemoryStorage) ConsumePushedAuthorizationRequest(ctx context.Context, requestURI string) (*models.PushedAuthorizationRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	request, exists := m.pushedRequests[requestURI]
+	if !exists {
+		return nil, nil
+	}
+	delete(m.pushedRequests, requestURI)
+
+	if time.Now().After(request.ExpiresAt) {
+		return nil, nil
+	}
+
+	return request, nil
+}
+
+func (m *MemoryStorage) MarkClientAssertionUsed(ctx context.Context, clientID, jti string, expiresAt time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := clientID + ":" + jti
+	if seenUntil, seen := m.usedAssertions[key]; seen && time.Now().Before(seenUntil) {
+		return true, nil
+	}
+	m.usedAssertions[key] = expiresAt
+	return false, nil
+}
+
+func (m *MemoryStorage) MarkDPoPProofUsed(ctx context.Context, jkt, jti string, expiresAt time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := jkt + ":" + jti
+	if seenUntil, seen := m.usedDPoPProofs[key]; seen && time.Now().Before(seenUntil) {
+		return true, nil
+	}
+	m.usedDPoPProofs[key] = expiresAt
+	return false, nil
+}
+
+func (m *MemoryStorage) SaveDPoPNonce(ctx context.Context, nonce string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.dpopNonces[nonce] = expiresAt
+	return nil
+}
+
+func (m *MemoryStorage) DPoPNonceValid(ctx context.Context, nonce string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	expiresAt, exists := m.dpopNonces[nonce]
+	return exists && time.Now().Before(expiresAt), nil
+}
+
+func (m *MemoryStorage) ConsumeAuthorizationCode(ctx context.Context, code string) (*models.AuthorizationCode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	authCode, exists := m.authCodes[code]
+	if !exists {
+		return nil, nil
+	}
+	delete(m.authCodes, code)
+
+	if time.Now().After(authCode.ExpiresAt) {
+		return nil, nil
+	}
+
+	return authCode, nil
+}
+
+func (m *MemoryStorage) SaveDeviceAuthorization(ctx context.Context, auth *models.DeviceAuthorization) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := *auth
+	m.deviceAuths[auth.DeviceCode] = &stored
+	m.deviceUserCodes[auth.UserCode] = auth.DeviceCode
+	return nil
+}
+
+func (m *MemoryStorage) GetDeviceAuthorization(ctx context.Context, deviceCode string) (*models.DeviceAuthorization, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.deviceAuthorization(deviceCode), nil
+}
+
+func (m *MemoryStorage) GetDeviceAuthorizationByUserCode(ctx context.Context, userCode string) (*models.DeviceAuthorization, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	deviceCode, exists := m.deviceUserCodes[userCode]
+	if !exists {
+		return nil, nil
+	}
+
+	return m.deviceAuthorization(deviceCode), nil
+}
+
+func (m *MemoryStorage) ConsumeDeviceAuthorization(ctx context.Context, deviceCode string) (*models.DeviceAuthorization, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	auth := m.deviceAuthorization(deviceCode)
+	if stored, exists := m.deviceAuths[deviceCode]; exists {
+		delete(m.deviceUserCodes, stored.UserCode)
+	}
+	delete(m.deviceAuths, deviceCode)
+	delete(m.devicePolls, deviceCode)
+
+	return auth, nil
+}
+
+// deviceAuthorization returns a copy of a live device authorization, since
+// callers modify it before saving; m.mu must be held
+func (m *MemoryStorage) deviceAuthorization(deviceCode string) *models.DeviceAuthorization {
+	auth, exists := m.deviceAuths[deviceCode]
+	if !exists || time.Now().After(auth.ExpiresAt) {
+		return nil
+	}
+
+	result := *auth
+	return &result
+}
+
+func (m *MemoryStorage) RecordDevicePoll(ctx context.Context, deviceCode string, interval time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	last, polled := m.devicePolls[deviceCode]
+	m.devicePolls[deviceCode] = now
+	return polled && now.Sub(last) < interval, nil
+}
+
+func (m *MemoryStorage) RecordUserCodeFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	failures, exists := m.userCodeFailures[key]
+	if !exists || now.After(failures.ExpiresAt) {
+		failures = &failureCount{ExpiresAt: now.Add(window)}
+		m.userCodeFailures[key] = failures
+	}
+	failures.Count++
+	return failures.Count, nil
+}
+
+func (m *MemoryStorage) UserCodeFailures(ctx context.Context, key string) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	failures, exists := m.userCodeFailures[key]
+	if !exists || time.Now().After(failures.ExpiresAt) {
+		return 0, nil
+	}
+	return failures.Count, nil
+}
+
+func (m *MemoryStorage) SaveAccessToken(ctx context.Context, token *models.AccessToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.accessTokens[token.Token] = token
+	return nil
+}
+
+func (m *MemoryStorage) GetAccessToken(ctx context.Context, token string) (*models.AccessToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	accessToken, exists := m.accessTokens[token]
+	if !exists || time.Now().After(accessToken.ExpiresAt) {
+		return nil, nil
+	}
+
+	return accessToken, nil
+}
+
+func (m *MemoryStorage) DeleteAccessToken(ctx context.Context, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.accessTokens, token)
+	return nil
+}
+
+func (m *MemoryStorage) SaveRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.refreshTokens[token.Token] = token
+	return nil
+}
+
+func (m *MemoryStorage) GetRefreshToken(ctx context.Context, token string) (*models.RefreshToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	refreshToken, exists := m.refreshTokens[token]
+	if !exists || time.Now().After(refreshToken.ExpiresAt) {
+		return nil, nil
+	}
+
+	result := *refreshToken
+	result.Used = m.usedRefresh[token]
+	return &result, nil
+}
+
+func (m *MemoryStorage) MarkRefreshTokenUsed(ctx context.Context, token string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	used := m.usedRefresh[token]
+	m.usedRefresh[token] = true
+	return used, nil
+}
+
+func (m *MemoryStorage) DeleteRefreshToken(ctx context.Context, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.refreshTokens, token)
+	delete(m.usedRefresh, token)
+	return nil
+}
+
+func (m *MemoryStorage) RevokeTokenFamily(ctx context.Context, familyID string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if expiresAt.After(m.revokedFamilies[familyID]) {
+		m.revokedFamilies[familyID] = expiresAt
+	}
+	return nil
+}
+
+func (m *MemoryStorage) IsTokenFamilyRevoked(ctx context.Context, familyID string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	expiresAt, exists := m.revokedFamilies[familyID]
+	return exists && time.Now().Before(expiresAt), nil
+}
+
+func (m *MemoryStorage) RevokeClientTokens(ctx context.Context, username, clientID string, revokedAt, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.revokedClients[username+"\x00"+clientID] = clientRevocation{RevokedAt: revokedAt, ExpiresAt: expiresAt}
+	return nil
+}
+
+func (m *MemoryStorage) GetClientTokensRevokedAt(ctx context.Context, username, clientID string) (time.Time, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	revocation, exists := m.revokedClients[username+"\x00"+clientID]
+	if !exists || time.Now().After(revocation.ExpiresAt) {
+		return time.Time{}, nil
+	}
+
+	return revocation.RevokedAt, nil
+}
+
 // cleanupRoutine runs every 5 minutes to clean up expired sessions
 func (m *MemoryStorage) cleanupRoutine() {
 	ticker := time.NewTicker(5 * time.Minute)
@@ -149,4 +601,103 @@ func (m *MemoryStorage) cleanup() {
 			delete(m.sessions, sessionID)
 		}
 	}
+	for sessionID := range m.sessionClients {
+		if _, exists := m.sessions[sessionID]; !exists {
+			delete(m.sessionClients, sessionID)
+		}
+	}
+
+	// Clean up delivery logs with no recent attempts
+	for clientID, log := range m.backchannelLog {
+		if len(log) == 0 || now.Sub(log[0].Time) > backchannelLogoutLogRetention {
+			delete(m.backchannelLog, clientID)
+		}
+	}
+
+	// Clean up expired authorization requests
+	for requestID, request := range m.authRequests {
+		if now.After(request.ExpiresAt) {
+			delete(m.authRequests, requestID)
+		}
+	}
+
+	// Clean up expired pushed authorization requests
+	for requestURI, request := range m.pushedRequests {
+		if now.After(request.ExpiresAt) {
+			delete(m.pushedRequests, requestURI)
+		}
+	}
+
+	// Clean up client assertion jtis that can no longer be replayed
+	for key, expiresAt := range m.usedAssertions {
+		if now.After(expiresAt) {
+			delete(m.usedAssertions, key)
+		}
+	}
+
+	// Clean up DPoP proof jtis that can no longer be replayed
+	for key, expiresAt := range m.usedDPoPProofs {
+		if now.After(expiresAt) {
+			delete(m.usedDPoPProofs, key)
+		}
+	}
+
+	// Clean up expired DPoP nonces
+	for nonce, expiresAt := range m.dpopNonces {
+		if now.After(expiresAt) {
+			delete(m.dpopNonces, nonce)
+		}
+	}
+
+	// Clean up expired authorization codes
+	for code, authCode := range m.authCodes {
+		if now.After(authCode.ExpiresAt) {
+			delete(m.authCodes, code)
+		}
+	}
+
+	// Clean up expired device authorizations
+	for deviceCode, auth := range m.deviceAuths {
+		if now.After(auth.ExpiresAt) {
+			delete(m.deviceAuths, deviceCode)
+			delete(m.deviceUserCodes, auth.UserCode)
+			delete(m.devicePolls, deviceCode)
+		}
+	}
+
+	// Clean up user code failure counts whose window has passed
+	for key, failures := range m.userCodeFailures {
+		if now.After(failures.ExpiresAt) {
+			delete(m.userCodeFailures, key)
+		}
+	}
+
+	// Clean up expired access tokens
+	for token, accessToken := range m.accessTokens {
+		if now.After(accessToken.ExpiresAt) {
+			delete(m.accessTokens, token)
+		}
+	}
+
+	// Clean up expired refresh tokens
+	for token, refreshToken := range m.refreshTokens {
+		if now.After(refreshToken.ExpiresAt) {
+			delete(m.refreshTokens, token)
+			delete(m.usedRefresh, token)
+		}
+	}
+
+	// Clean up family revocations that outlived their tokens
+	for familyID, expiresAt := range m.revokedFamilies {
+		if now.After(expiresAt) {
+			delete(m.revokedFamilies, familyID)
+		}
+	}
+
+	// Clean up client revocations that outlived their tokens
+	for key, revocation := range m.revokedClients {
+		if now.After(revocation.ExpiresAt) {
+			delete(m.revokedClients, key)
+		}
+	}
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/andyleap/passkey/internal/models"
@@ -107,12 +108,143 @@ func (r *RedisStorage) GetSession(ctx context.Context, sessionID string) (*model
 		return nil, nil
 	}
 
+	clientIDs, err := r.client.SMembers(ctx, fmt.Sprintf("session_clients:%s", sessionID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session clients: %w", err)
+	}
+	session.ClientIDs = clientIDs
+
 	return &session, nil
 }
 
 func (r *RedisStorage) DeleteSession(ctx context.Context, sessionID string) error {
 	key := fmt.Sprintf("session:%s", sessionID)
-	return r.client.Del(ctx, key).Err()
+	clientsKey := fmt.Sprintf("session_clients:%s", sessionID)
+	return r.client.Del(ctx, key, clientsKey).Err()
+}
+
+func (r *RedisStorage) AddSessionClient(ctx context.Context, sessionID, clientID string, expiresAt time.Time) error {
+	key := fmt.Sprintf("session_clients:%s", sessionID)
+
+	pipe := r.client.TxPipeline()
+	pipe.SAdd(ctx, key, clientID)
+	pipe.ExpireAt(ctx, key, expiresAt)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to add session client: %w", err)
+	}
+
+	return nil
+}
+
+// backchannelLogoutQueueKey is a sorted set of queued back-channel logout
+// delivery IDs, scored by when they are next due
+const backchannelLogoutQueueKey = "backchannel_logout_queue"
+
+func (r *RedisStorage) QueueBackchannelLogout(ctx context.Context, delivery *models.BackchannelLogoutDelivery) error {
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return fmt.Errorf("failed to marshal back-channel logout delivery: %w", err)
+	}
+
+	pipe := r.client.TxPipeline()
+	pipe.Set(ctx, fmt.Sprintf("backchannel_logout:%s", delivery.ID), data, 0)
+	pipe.ZAdd(ctx, backchannelLogoutQueueKey, redis.Z{
+		Score:  float64(delivery.NextAttemptAt.UnixMilli()),
+		Member: delivery.ID,
+	})
+	pipe.Del(ctx, fmt.Sprintf("backchannel_logout_claim:%s", delivery.ID))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to queue back-channel logout delivery: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RedisStorage) ClaimBackchannelLogouts(ctx context.Context, now time.Time, lease time.Duration) ([]*models.BackchannelLogoutDelivery, error) {
+	ids, err := r.client.ZRangeByScore(ctx, backchannelLogoutQueueKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.UnixMilli(), 10),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list back-channel logout deliveries: %w", err)
+	}
+
+	var claimed []*models.BackchannelLogoutDelivery
+	for _, id := range ids {
+		// SETNX lets only one instance work on a delivery until the lease runs out
+		ok, err := r.client.SetNX(ctx, fmt.Sprintf("backchannel_logout_claim:%s", id), "1", lease).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to claim back-channel logout delivery: %w", err)
+		}
+		if !ok {
+			continue
+		}
+
+		data, err := r.client.Get(ctx, fmt.Sprintf("backchannel_logout:%s", id)).Result()
+		if err == redis.Nil {
+			r.client.ZRem(ctx, backchannelLogoutQueueKey, id)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get back-channel logout delivery: %w", err)
+		}
+
+		var delivery models.BackchannelLogoutDelivery
+		if err := json.Unmarshal([]byte(data), &delivery); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal back-channel logout delivery: %w", err)
+		}
+		claimed = append(claimed, &delivery)
+	}
+
+	return claimed, nil
+}
+
+func (r *RedisStorage) CompleteBackchannelLogout(ctx context.Context, deliveryID string) error {
+	pipe := r.client.TxPipeline()
+	pipe.ZRem(ctx, backchannelLogoutQueueKey, deliveryID)
+	pipe.Del(ctx, fmt.Sprintf("backchannel_logout:%s", deliveryID), fmt.Sprintf("backchannel_logout_claim:%s", deliveryID))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to complete back-channel logout delivery: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RedisStorage) RecordBackchannelLogoutAttempt(ctx context.Context, attempt *models.BackchannelLogoutAttempt) error {
+	key := fmt.Sprintf("backchannel_logout_log:%s", attempt.ClientID)
+
+	data, err := json.Marshal(attempt)
+	if err != nil {
+		return fmt.Errorf("failed to marshal back-channel logout attempt: %w", err)
+	}
+
+	pipe := r.client.TxPipeline()
+	pipe.LPush(ctx, key, data)
+	pipe.LTrim(ctx, key, 0, backchannelLogoutLogSize-1)
+	pipe.Expire(ctx, key, backchannelLogoutLogRetention)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to record back-channel logout attempt: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RedisStorage) GetBackchannelLogoutAttempts(ctx context.Context, clientID string) ([]*models.BackchannelLogoutAttempt, error) {
+	entries, err := r.client.LRange(ctx, fmt.Sprintf("backchannel_logout_log:%s", clientID), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get back-channel logout attempts: %w", err)
+	}
+
+	attempts := make([]*models.BackchannelLogoutAttempt, 0, len(entries))
+	for _, entry := range entries {
+		var attempt models.BackchannelLogoutAttempt
+		if err := json.Unmarshal([]byte(entry), &attempt); err != nil {
+			continue // Skip malformed entries
+		}
+		attempts = append(attempts, &attempt)
+	}
+
+	return attempts, nil
 }
 
 func (r *RedisStorage) GetUserSessions(ctx context.Context, username string) ([]*models.Session, error) {
@@ -148,3 +280,502 @@ func (r *RedisStorage) GetUserSessions(ctx context.Context, username string) ([]
 
 	return userSessions, nil
 }
+
+func (r *RedisStorage) SaveAuthorizationRequest(ctx context.Context, request *models.AuthorizationRequest) error {
+	key := fmt.Sprintf("auth_request:%s", request.ID)
+
+	data, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal authorization request: %w", err)
+	}
+
+	ttl := time.Until(request.ExpiresAt)
+	if ttl <= 0 {
+		return fmt.Errorf("authorization request already expired")
+	}
+
+	err = r.client.Set(ctx, key, data, ttl).Err()
+	if err != nil {
+		return fmt.Errorf("failed to save authorization request: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RedisStorage) GetAuthorizationRequest(ctx context.Context, requestID string) (*models.AuthorizationRequest, error) {
+	key := fmt.Sprintf("auth_request:%s", requestID)
+
+	data, err := r.client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get authorization request: %w", err)
+	}
+
+	var request models.AuthorizationRequest
+	if err := json.Unmarshal([]byte(data), &request); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal authorization request: %w", err)
+	}
+
+	return &request, nil
+}
+
+func (r *RedisStorage) ConsumeAuthorizationRequest(ctx context.Context, requestID string) (*models.AuthorizationRequest, error) {
+	key := fmt.Sprintf("auth_request:%s", requestID)
+
+	// GETDEL makes retrieval and deletion a single atomic step
+	data, err := r.client.GetDel(ctx, key).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume authorization request: %w", err)
+	}
+
+	var request models.AuthorizationRequest
+	if err := json.Unmarshal([]byte(data), &request); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal authorization request: %w", err)
+	}
+
+	return &request, nil
+}
+
+func (r *RedisStorage) SavePushedAuthorizationRequest(ctx context.Context, request *models.PushedAuthorizationRequest) error {
+	key := fmt.Sprintf("par:%s", request.RequestURI)
+
+	data, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pushed authorization request: %w", err)
+	}
+
+	ttl := time.Until(request.ExpiresAt)
+	if ttl <= 0 {
+		return fmt.Errorf("pushed authorization request already expired")
+	}
+
+	err = r.client.Set(ctx, key, data, ttl).Err()
+	if err != nil {
+		return fmt.Errorf("failed to save pushed authorization request: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RedisStorage) ConsumePushedAuthorizationRequest(ctx context.Context, requestURI string) (*models.PushedAuthorizationRequest, error) {
+	key := fmt.Sprintf("par:%s", requestURI)
+
+	// GETDEL makes retrieval and deletion a single atomic step
+	data, err := r.client.GetDel(ctx, key).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume pushed authorization request: %w", err)
+	}
+
+	var request models.PushedAuthorizationRequest
+	if err := json.Unmarshal([]byte(data), &request); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal pushed authorization request: %w", err)
+	}
+
+	return &request, nil
+}
+
+func (r *RedisStorage) MarkClientAssertionUsed(ctx context.Context, clientID, jti string, expiresAt time.Time) (bool, error) {
+	key := fmt.Sprintf("client_assertion:%s:%s", clientID, jti)
+
+	// Keep the marker as long as the assertion could still be presented
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+
+	set, err := r.client.SetNX(ctx, key, 1, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to record client assertion: %w", err)
+	}
+
+	return !set, nil
+}
+
+func (r *RedisStorage) MarkDPoPProofUsed(ctx context.Context, jkt, jti string, expiresAt time.Time) (bool, error) {
+	key := fmt.Sprintf("dpop_proof:%s:%s", jkt, jti)
+
+	// Keep the marker as long as the proof could still be presented
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+
+	set, err := r.client.SetNX(ctx, key, 1, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to record DPoP proof: %w", err)
+	}
+
+	return !set, nil
+}
+
+func (r *RedisStorage) SaveDPoPNonce(ctx context.Context, nonce string, expiresAt time.Time) error {
+	key := fmt.Sprintf("dpop_nonce:%s", nonce)
+
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+
+	if err := r.client.Set(ctx, key, 1, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to save DPoP nonce: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RedisStorage) DPoPNonceValid(ctx context.Context, nonce string) (bool, error) {
+	key := fmt.Sprintf("dpop_nonce:%s", nonce)
+
+	count, err := r.client.Exists(ctx, key).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check DPoP nonce: %w", err)
+	}
+
+	return count > 0, nil
+}
+
+func (r *RedisStorage) SaveAuthorizationCode(ctx context.Context, code *models.AuthorizationCode) error {
+	key := fmt.Sprintf("auth_code:%s", code.Code)
+
+	data, err := json.Marshal(code)
+	if err != nil {
+		return fmt.Errorf("failed to marshal authorization code: %w", err)
+	}
+
+	ttl := time.Until(code.ExpiresAt)
+	if ttl <= 0 {
+		return fmt.Errorf("authorization code already expired")
+	}
+
+	err = r.client.Set(ctx, key, data, ttl).Err()
+	if err != nil {
+		return fmt.Errorf("failed to save authorization code: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RedisStorage) ConsumeAuthorizationCode(ctx context.Context, code string) (*models.AuthorizationCode, error) {
+	key := fmt.Sprintf("auth_code:%s", code)
+
+	// GETDEL makes retrieval and deletion a single atomic step
+	data, err := r.client.GetDel(ctx, key).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume authorization code: %w", err)
+	}
+
+	var authCode models.AuthorizationCode
+	if err := json.Unmarshal([]byte(data), &authCode); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal authorization code: %w", err)
+	}
+
+	return &authCode, nil
+}
+
+func (r *RedisStorage) SaveDeviceAuthorization(ctx context.Context, auth *models.DeviceAuthorization) error {
+	key := fmt.Sprintf("device_code:%s", auth.DeviceCode)
+	userCodeKey := fmt.Sprintf("device_user_code:%s", auth.UserCode)
+
+	data, err := json.Marshal(auth)
+	if err != nil {
+		return fmt.Errorf("failed to marshal device authorization: %w", err)
+	}
+
+	ttl := time.Until(auth.ExpiresAt)
+	if ttl <= 0 {
+		return fmt.Errorf("device authorization already expired")
+	}
+
+	pipe := r.client.TxPipeline()
+	pipe.Set(ctx, key, data, ttl)
+	pipe.Set(ctx, userCodeKey, auth.DeviceCode, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save device authorization: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RedisStorage) GetDeviceAuthorization(ctx context.Context, deviceCode string) (*models.DeviceAuthorization, error) {
+	key := fmt.Sprintf("device_code:%s", deviceCode)
+
+	data, err := r.client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device authorization: %w", err)
+	}
+
+	var auth models.DeviceAuthorization
+	if err := json.Unmarshal([]byte(data), &auth); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal device authorization: %w", err)
+	}
+
+	return &auth, nil
+}
+
+func (r *RedisStorage) GetDeviceAuthorizationByUserCode(ctx context.Context, userCode string) (*models.DeviceAuthorization, error) {
+	key := fmt.Sprintf("device_user_code:%s", userCode)
+
+	deviceCode, err := r.client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device user code: %w", err)
+	}
+
+	return r.GetDeviceAuthorization(ctx, deviceCode)
+}
+
+func (r *RedisStorage) ConsumeDeviceAuthorization(ctx context.Context, deviceCode string) (*models.DeviceAuthorization, error) {
+	key := fmt.Sprintf("device_code:%s", deviceCode)
+
+	// GETDEL makes retrieval and deletion a single atomic step
+	data, err := r.client.GetDel(ctx, key).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume device authorization: %w", err)
+	}
+
+	var auth models.DeviceAuthorization
+	if err := json.Unmarshal([]byte(data), &auth); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal device authorization: %w", err)
+	}
+
+	r.client.Del(ctx, fmt.Sprintf("device_user_code:%s", auth.UserCode), fmt.Sprintf("device_poll:%s", deviceCode))
+
+	return &auth, nil
+}
+
+func (r *RedisStorage) RecordDevicePoll(ctx context.Context, deviceCode string, interval time.Duration) (bool, error) {
+	key := fmt.Sprintf("device_poll:%s", deviceCode)
+
+	// The marker outlives the interval only if the client polls too fast
+	set, err := r.client.SetNX(ctx, key, 1, interval).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to record device poll: %w", err)
+	}
+	if !set {
+		if err := r.client.Expire(ctx, key, interval).Err(); err != nil {
+			return false, fmt.Errorf("failed to record device poll: %w", err)
+		}
+	}
+
+	return !set, nil
+}
+
+func (r *RedisStorage) RecordUserCodeFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	counterKey := fmt.Sprintf("user_code_failures:%s", key)
+
+	// The counter is created with the window as its TTL on the first failure;
+	// MULTI makes sure it is never left without one
+	pipe := r.client.TxPipeline()
+	pipe.SetNX(ctx, counterKey, 0, window)
+	count := pipe.Incr(ctx, counterKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to record user code failure: %w", err)
+	}
+
+	return int(count.Val()), nil
+}
+
+func (r *RedisStorage) UserCodeFailures(ctx context.Context, key string) (int, error) {
+	count, err := r.client.Get(ctx, fmt.Sprintf("user_code_failures:%s", key)).Int()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get user code failures: %w", err)
+	}
+
+	return count, nil
+}
+
+func (r *RedisStorage) SaveAccessToken(ctx context.Context, token *models.AccessToken) error {
+	key := fmt.Sprintf("access_token:%s", token.Token)
+
+	data, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("failed to marshal access token: %w", err)
+	}
+
+	ttl := time.Until(token.ExpiresAt)
+	if ttl <= 0 {
+		return fmt.Errorf("access token already expired")
+	}
+
+	err = r.client.Set(ctx, key, data, ttl).Err()
+	if err != nil {
+		return fmt.Errorf("failed to save access token: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RedisStorage) GetAccessToken(ctx context.Context, token string) (*models.AccessToken, error) {
+	key := fmt.Sprintf("access_token:%s", token)
+
+	data, err := r.client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get access token: %w", err)
+	}
+
+	var accessToken models.AccessToken
+	if err := json.Unmarshal([]byte(data), &accessToken); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal access token: %w", err)
+	}
+
+	return &accessToken, nil
+}
+
+func (r *RedisStorage) DeleteAccessToken(ctx context.Context, token string) error {
+	key := fmt.Sprintf("access_token:%s", token)
+	return r.client.Del(ctx, key).Err()
+}
+
+func (r *RedisStorage) SaveRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	key := fmt.Sprintf("refresh_token:%s", token.Token)
+
+	data, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("failed to marshal refresh token: %w", err)
+	}
+
+	ttl := time.Until(token.ExpiresAt)
+	if ttl <= 0 {
+		return fmt.Errorf("refresh token already expired")
+	}
+
+	err = r.client.Set(ctx, key, data, ttl).Err()
+	if err != nil {
+		return fmt.Errorf("failed to save refresh token: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RedisStorage) GetRefreshToken(ctx context.Context, token string) (*models.RefreshToken, error) {
+	key := fmt.Sprintf("refresh_token:%s", token)
+	usedKey := fmt.Sprintf("refresh_token_used:%s", token)
+
+	values, err := r.client.MGet(ctx, key, usedKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	data, ok := values[0].(string)
+	if !ok {
+		return nil, nil
+	}
+
+	var refreshToken models.RefreshToken
+	if err := json.Unmarshal([]byte(data), &refreshToken); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal refresh token: %w", err)
+	}
+	refreshToken.Used = values[1] != nil
+
+	return &refreshToken, nil
+}
+
+func (r *RedisStorage) MarkRefreshTokenUsed(ctx context.Context, token string) (bool, error) {
+	key := fmt.Sprintf("refresh_token_used:%s", token)
+
+	// Keep the marker as long as the token itself could still be presented
+	ttl, err := r.client.TTL(ctx, fmt.Sprintf("refresh_token:%s", token)).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to get refresh token TTL: %w", err)
+	}
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+
+	set, err := r.client.SetNX(ctx, key, 1, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to mark refresh token used: %w", err)
+	}
+
+	return !set, nil
+}
+
+func (r *RedisStorage) DeleteRefreshToken(ctx context.Context, token string) error {
+	return r.client.Del(ctx, fmt.Sprintf("refresh_token:%s", token), fmt.Sprintf("refresh_token_used:%s", token)).Err()
+}
+
+func (r *RedisStorage) RevokeTokenFamily(ctx context.Context, familyID string, expiresAt time.Time) error {
+	key := fmt.Sprintf("revoked_family:%s", familyID)
+
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+
+	current, err := r.client.TTL(ctx, key).Result()
+	if err != nil {
+		return fmt.Errorf("failed to get family revocation TTL: %w", err)
+	}
+	if current >= ttl {
+		return nil
+	}
+
+	if err := r.client.Set(ctx, key, 1, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to revoke token family: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RedisStorage) IsTokenFamilyRevoked(ctx context.Context, familyID string) (bool, error) {
+	n, err := r.client.Exists(ctx, fmt.Sprintf("revoked_family:%s", familyID)).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check token family: %w", err)
+	}
+
+	return n > 0, nil
+}
+
+func (r *RedisStorage) RevokeClientTokens(ctx context.Context, username, clientID string, revokedAt, expiresAt time.Time) error {
+	key := fmt.Sprintf("revoked_client:%s:%s", username, clientID)
+
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+
+	if err := r.client.Set(ctx, key, revokedAt.UnixNano(), ttl).Err(); err != nil {
+		return fmt.Errorf("failed to revoke client tokens: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RedisStorage) GetClientTokensRevokedAt(ctx context.Context, username, clientID string) (time.Time, error) {
+	key := fmt.Sprintf("revoked_client:%s:%s", username, clientID)
+
+	nanos, err := r.client.Get(ctx, key).Int64()
+	if err == redis.Nil {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get client revocation: %w", err)
+	}
+
+	return time.Unix(0, nanos), nil
+}
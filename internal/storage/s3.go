@@ -130,3 +130,195 @@ func (s *S3Storage) UserExists(ctx context.Context, username string) (bool, erro
 
 	return true, nil
 }
+
+func (s *S3Storage) GetKeySet(ctx context.Context) (*models.KeySet, error) {
+	key := "keys/keyset.json"
+
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key set from S3: %w", err)
+	}
+	defer object.Close()
+
+	data, err := io.ReadAll(object)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read key set data: %w", err)
+	}
+
+	var keySet models.KeySet
+	if err := json.Unmarshal(data, &keySet); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal key set: %w", err)
+	}
+
+	return &keySet, nil
+}
+
+func (s *S3Storage) SaveKeySet(ctx context.Context, keySet *models.KeySet) error {
+	key := "keys/keyset.json"
+
+	data, err := json.Marshal(keySet)
+	if err != nil {
+		return fmt.Errorf("failed to marshal key set: %w", err)
+	}
+
+	_, err = s.client.PutObject(ctx, s.bucket, key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType: "application/json",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save key set to S3: %w", err)
+	}
+
+	return nil
+}
+
+func (s *S3Storage) GetClient(ctx context.Context, clientID string) (*models.Client, error) {
+	key := fmt.Sprintf("clients/%s.json", clientID)
+
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client from S3: %w", err)
+	}
+	defer object.Close()
+
+	data, err := io.ReadAll(object)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read client data: %w", err)
+	}
+
+	var client models.Client
+	if err := json.Unmarshal(data, &client); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal client: %w", err)
+	}
+
+	return &client, nil
+}
+
+func (s *S3Storage) SaveClient(ctx context.Context, client *models.Client) error {
+	key := fmt.Sprintf("clients/%s.json", client.ID)
+
+	data, err := json.Marshal(client)
+	if err != nil {
+		return fmt.Errorf("failed to marshal client: %w", err)
+	}
+
+	_, err = s.client.PutObject(ctx, s.bucket, key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType: "application/json",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save client to S3: %w", err)
+	}
+
+	return nil
+}
+
+func (s *S3Storage) DeleteClient(ctx context.Context, clientID string) error {
+	key := fmt.Sprintf("clients/%s.json", clientID)
+
+	if err := s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to delete client from S3: %w", err)
+	}
+
+	return nil
+}
+
+func (s *S3Storage) GetConsentGrant(ctx context.Context, username, clientID string) (*models.ConsentGrant, error) {
+	key := fmt.Sprintf("grants/%s/%s.json", username, clientID)
+
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get consent grant from S3: %w", err)
+	}
+	defer object.Close()
+
+	data, err := io.ReadAll(object)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read consent grant data: %w", err)
+	}
+
+	var grant models.ConsentGrant
+	if err := json.Unmarshal(data, &grant); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal consent grant: %w", err)
+	}
+
+	return &grant, nil
+}
+
+func (s *S3Storage) GetConsentGrants(ctx context.Context, username string) ([]*models.ConsentGrant, error) {
+	objectCh := s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix: fmt.Sprintf("grants/%s/", username),
+	})
+
+	var grants []*models.ConsentGrant
+	for object := range objectCh {
+		if object.Err != nil {
+			return nil, fmt.Errorf("failed to list consent grants: %w", object.Err)
+		}
+
+		if !strings.HasSuffix(object.Key, ".json") {
+			continue
+		}
+
+		obj, err := s.client.GetObject(ctx, s.bucket, object.Key, minio.GetObjectOptions{})
+		if err != nil {
+			continue // Skip problematic objects
+		}
+
+		data, err := io.ReadAll(obj)
+		obj.Close()
+		if err != nil {
+			continue // Skip objects that can't be read
+		}
+
+		var grant models.ConsentGrant
+		if err := json.Unmarshal(data, &grant); err != nil {
+			continue // Skip malformed objects
+		}
+		grants = append(grants, &grant)
+	}
+
+	return grants, nil
+}
+
+func (s *S3Storage) SaveConsentGrant(ctx context.Context, username string, grant *models.ConsentGrant) error {
+	key := fmt.Sprintf("grants/%s/%s.json", username, grant.ClientID)
+
+	data, err := json.Marshal(grant)
+	if err != nil {
+		return fmt.Errorf("failed to marshal consent grant: %w", err)
+	}
+
+	_, err = s.client.PutObject(ctx, s.bucket, key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType: "application/json",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save consent grant to S3: %w", err)
+	}
+
+	return nil
+}
+
+func (s *S3Storage) DeleteConsentGrant(ctx context.Context, username, clientID string) (bool, error) {
+	key := fmt.Sprintf("grants/%s/%s.json", username, clientID)
+
+	if _, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{}); err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check consent grant: %w", err)
+	}
+
+	if err := s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		return false, fmt.Errorf("failed to delete consent grant from S3: %w", err)
+	}
+
+	return true, nil
+}
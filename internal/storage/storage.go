@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"time"
 
 	"github.com/andyleap/passkey/internal/models"
 )
@@ -13,6 +14,44 @@ type UserStorage interface {
 	UserExists(ctx context.Context, username string) (bool, error)
 }
 
+// ConsentStorage persists the scopes users have approved per OAuth client.
+// Each grant is stored under its own key, apart from the user record, so
+// saving one never overwrites a concurrent change to the user's credentials.
+type ConsentStorage interface {
+	// GetConsentGrant returns nil if the user hasn't granted the client access
+	GetConsentGrant(ctx context.Context, username, clientID string) (*models.ConsentGrant, error)
+	GetConsentGrants(ctx context.Context, username string) ([]*models.ConsentGrant, error)
+	SaveConsentGrant(ctx context.Context, username string, grant *models.ConsentGrant) error
+	// DeleteConsentGrant reports whether there was a grant to delete
+	DeleteConsentGrant(ctx context.Context, username, clientID string) (bool, error)
+}
+
+// KeyStorage persists token signing keys alongside user data
+type KeyStorage interface {
+	// GetKeySet returns nil if no key set has been stored yet
+	GetKeySet(ctx context.Context) (*models.KeySet, error)
+	SaveKeySet(ctx context.Context, keySet *models.KeySet) error
+}
+
+// ClientStorage is the registry of OAuth clients. Clients can be added,
+// updated or disabled at runtime by saving them again.
+type ClientStorage interface {
+	// GetClient returns nil if the client doesn't exist. Callers may modify
+	// the returned client; changes only take effect once saved.
+	GetClient(ctx context.Context, clientID string) (*models.Client, error)
+	SaveClient(ctx context.Context, client *models.Client) error
+	DeleteClient(ctx context.Context, clientID string) error
+}
+
+const (
+	// backchannelLogoutLogSize is how many delivery attempts are kept per
+	// client
+	backchannelLogoutLogSize = 100
+	// backchannelLogoutLogRetention is how long a client's delivery log is
+	// kept after its latest attempt
+	backchannelLogoutLogRetention = 7 * 24 * time.Hour
+)
+
 type SessionStorage interface {
 	SaveWebAuthnSession(ctx context.Context, username string, session *models.WebAuthnSession) error
 	GetWebAuthnSession(ctx context.Context, username string) (*models.WebAuthnSession, error)
@@ -22,4 +61,98 @@ type SessionStorage interface {
 	GetSession(ctx context.Context, sessionID string) (*models.Session, error)
 	DeleteSession(ctx context.Context, sessionID string) error
 	GetUserSessions(ctx context.Context, username string) ([]*models.Session, error)
+	// AddSessionClient records that a client was issued tokens during a
+	// session, kept until expiresAt. GetSession lists them in ClientIDs.
+	AddSessionClient(ctx context.Context, sessionID, clientID string, expiresAt time.Time) error
+
+	// QueueBackchannelLogout saves a logout token delivery to be attempted at
+	// its NextAttemptAt, replacing the queued delivery with the same ID and
+	// releasing any claim on it
+	QueueBackchannelLogout(ctx context.Context, delivery *models.BackchannelLogoutDelivery) error
+	// ClaimBackchannelLogouts returns the queued deliveries due by now that no
+	// other instance is working on, and claims them for lease. A delivery
+	// whose claim runs out before it is queued again or completed is
+	// returned again, so none are lost if the process stops.
+	ClaimBackchannelLogouts(ctx context.Context, now time.Time, lease time.Duration) ([]*models.BackchannelLogoutDelivery, error)
+	// CompleteBackchannelLogout removes a delivery from the queue
+	CompleteBackchannelLogout(ctx context.Context, deliveryID string) error
+	// RecordBackchannelLogoutAttempt adds an attempt to its client's delivery
+	// log, which keeps the most recent attempts for a limited time
+	RecordBackchannelLogoutAttempt(ctx context.Context, attempt *models.BackchannelLogoutAttempt) error
+	// GetBackchannelLogoutAttempts returns a client's logged attempts, newest
+	// first
+	GetBackchannelLogoutAttempts(ctx context.Context, clientID string) ([]*models.BackchannelLogoutAttempt, error)
+
+	SaveAuthorizationRequest(ctx context.Context, request *models.AuthorizationRequest) error
+	GetAuthorizationRequest(ctx context.Context, requestID string) (*models.AuthorizationRequest, error)
+	// ConsumeAuthorizationRequest atomically retrieves and deletes a pending
+	// authorization request so it can only be completed once
+	ConsumeAuthorizationRequest(ctx context.Context, requestID string) (*models.AuthorizationRequest, error)
+
+	SavePushedAuthorizationRequest(ctx context.Context, request *models.PushedAuthorizationRequest) error
+	// ConsumePushedAuthorizationRequest atomically retrieves and deletes a
+	// pushed request so its request_uri can only be used once
+	ConsumePushedAuthorizationRequest(ctx context.Context, requestURI string) (*models.PushedAuthorizationRequest, error)
+
+	// MarkClientAssertionUsed atomically records the jti of a client
+	// assertion until it expires and reports whether it was already recorded
+	MarkClientAssertionUsed(ctx context.Context, clientID, jti string, expiresAt time.Time) (bool, error)
+
+	// MarkDPoPProofUsed atomically records the jti of a DPoP proof signed by
+	// the key with thumbprint jkt until expiresAt and reports whether it was
+	// already recorded
+	MarkDPoPProofUsed(ctx context.Context, jkt, jti string, expiresAt time.Time) (bool, error)
+	// SaveDPoPNonce records a nonce handed out for DPoP proofs until it expires
+	SaveDPoPNonce(ctx context.Context, nonce string, expiresAt time.Time) error
+	// DPoPNonceValid reports whether a DPoP nonce was handed out and hasn't
+	// expired
+	DPoPNonceValid(ctx context.Context, nonce string) (bool, error)
+
+	SaveAuthorizationCode(ctx context.Context, code *models.AuthorizationCode) error
+	// ConsumeAuthorizationCode atomically retrieves and deletes a code so it
+	// can only be redeemed once
+	ConsumeAuthorizationCode(ctx context.Context, code string) (*models.AuthorizationCode, error)
+
+	// SaveDeviceAuthorization stores a device authorization under its device
+	// code and its user code until it expires
+	SaveDeviceAuthorization(ctx context.Context, auth *models.DeviceAuthorization) error
+	GetDeviceAuthorization(ctx context.Context, deviceCode string) (*models.DeviceAuthorization, error)
+	GetDeviceAuthorizationByUserCode(ctx context.Context, userCode string) (*models.DeviceAuthorization, error)
+	// ConsumeDeviceAuthorization atomically retrieves and deletes a device
+	// authorization so it can only be redeemed once
+	ConsumeDeviceAuthorization(ctx context.Context, deviceCode string) (*models.DeviceAuthorization, error)
+	// RecordDevicePoll notes a token request for a device code and reports
+	// whether the previous one was less than interval ago
+	RecordDevicePoll(ctx context.Context, deviceCode string, interval time.Duration) (bool, error)
+	// RecordUserCodeFailure counts an unknown user code entered by key, in a
+	// window of the given length from the first failure, and returns the
+	// number counted so far
+	RecordUserCodeFailure(ctx context.Context, key string, window time.Duration) (int, error)
+	// UserCodeFailures returns the failures counted for key in its current
+	// window
+	UserCodeFailures(ctx context.Context, key string) (int, error)
+
+	SaveAccessToken(ctx context.Context, token *models.AccessToken) error
+	GetAccessToken(ctx context.Context, token string) (*models.AccessToken, error)
+	DeleteAccessToken(ctx context.Context, token string) error
+
+	SaveRefreshToken(ctx context.Context, token *models.RefreshToken) error
+	// GetRefreshToken also reports whether the token has been used
+	GetRefreshToken(ctx context.Context, token string) (*models.RefreshToken, error)
+	// MarkRefreshTokenUsed atomically flags a refresh token as used and
+	// reports whether it had already been used
+	MarkRefreshTokenUsed(ctx context.Context, token string) (bool, error)
+	DeleteRefreshToken(ctx context.Context, token string) error
+
+	// RevokeTokenFamily invalidates every access and refresh token of a family
+	// until expiresAt, after which all of them have expired anyway
+	RevokeTokenFamily(ctx context.Context, familyID string, expiresAt time.Time) error
+	IsTokenFamilyRevoked(ctx context.Context, familyID string) (bool, error)
+
+	// RevokeClientTokens invalidates every token a client was issued for a
+	// user before revokedAt; the record is kept until expiresAt
+	RevokeClientTokens(ctx context.Context, username, clientID string, revokedAt, expiresAt time.Time) error
+	// GetClientTokensRevokedAt returns the zero time if the user never revoked
+	// the client's access
+	GetClientTokensRevokedAt(ctx context.Context, username, clientID string) (time.Time, error)
 }
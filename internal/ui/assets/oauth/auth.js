@@ -79,7 +79,7 @@ async function handleLogin(username, loginResponse) {
     
     // Finish login
     const credentialData = credential.toJSON();
-    const verifyResponse = await fetch('/api/v1/login/finish?username=' + encodeURIComponent(username), {
+    const verifyResponse = await fetch('/api/v1/login/finish?sessionId=' + encodeURIComponent(options.sessionId), {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify(credentialData)
@@ -89,12 +89,13 @@ async function handleLogin(username, loginResponse) {
         throw new Error('Sign in failed: ' + verifyResponse.statusText);
     }
     
+    await verifyResponse.json();
     showMessage('Sign in successful! Redirecting...', 'success');
     
     // Save username for future use
     localStorage.setItem('passkey-username', username);
     
-    completeOAuthFlow(username);
+    completeOAuthFlow();
 }
 
 async function handleRegistration(username) {
@@ -134,42 +135,28 @@ async function handleRegistration(username) {
         throw new Error('Passkey creation failed: ' + verifyResponse.statusText);
     }
     
+    await verifyResponse.json();
     showMessage('Passkey created! Signing you in...', 'success');
     
     // Save username for future use
     localStorage.setItem('passkey-username', username);
     
-    completeOAuthFlow(username);
+    completeOAuthFlow();
 }
 
 
-async function completeOAuthFlow(username) {
-    try {
-        // Create authorization code and redirect
-        const response = await fetch('/oauth/complete', {
-            method: 'POST',
-            headers: { 'Content-Type': 'application/json' },
-            body: JSON.stringify({
-                username: username,
-                client_id: authData.client_id,
-                redirect_uri: authData.redirect_uri,
-                state: authData.state
-            })
-        });
-        
-        if (!response.ok) {
-            throw new Error('Failed to complete OAuth flow');
-        }
-        
-        const result = await response.json();
-        
-        // Redirect to the callback URL
-        window.location.href = result.redirect_url;
-        
-    } catch (error) {
-        console.error('OAuth completion error:', error);
-        showMessage('Failed to complete authentication flow: ' + error.message);
+function completeOAuthFlow() {
+    // The finish response set the session cookie the consent page, control
+    // panel and later sign-ins use
+    
+    // Pages other than /authorize say where to go after signing in
+    if (authData.continue_url) {
+        window.location.href = authData.continue_url;
+        return;
     }
+    
+    // Ask the user to approve the requested access
+    window.location.href = '/oauth/consent?request_id=' + encodeURIComponent(authData.request_id);
 }
 
 // Initialize event listeners when DOM is ready
@@ -177,8 +164,8 @@ ready(function() {
     const signInBtn = document.getElementById('signin-btn');
     const usernameInput = document.getElementById('username');
     
-    // Load saved username
-    const savedUsername = localStorage.getItem('passkey-username');
+    // Prefer the client's login_hint over the saved username
+    const savedUsername = authData.login_hint || localStorage.getItem('passkey-username');
     if (savedUsername && usernameInput) {
         usernameInput.value = savedUsername;
     }
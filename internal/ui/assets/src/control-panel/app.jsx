@@ -1,11 +1,12 @@
 import { useState, useEffect } from 'preact/hooks';
 import { CredentialsSection } from './components/CredentialsSection.jsx';
 import { SessionsSection } from './components/SessionsSection.jsx';
+import { GrantsSection } from './components/GrantsSection.jsx';
 import { Header } from './components/Header.jsx';
 import { apiRequest } from './utils/api.js';
 
 export function App() {
-    const [user, setUser] = useState({ username: 'Loading...', credentials: [], sessions: [] });
+    const [user, setUser] = useState({ username: 'Loading...', credentials: [], sessions: [], grants: [] });
     const [loading, setLoading] = useState(true);
     const [error, setError] = useState(null);
 
@@ -14,12 +15,13 @@ export function App() {
             setLoading(true);
             setError(null);
             
-            const [credentialsResponse, sessionsResponse] = await Promise.all([
+            const [credentialsResponse, sessionsResponse, grantsResponse] = await Promise.all([
                 apiRequest('/api/v1/user/credentials'),
-                apiRequest('/api/v1/user/sessions')
+                apiRequest('/api/v1/user/sessions'),
+                apiRequest('/api/v1/user/grants')
             ]);
 
-            if (!credentialsResponse || !sessionsResponse) {
+            if (!credentialsResponse || !sessionsResponse || !grantsResponse) {
                 return; // apiRequest handles redirects
             }
 
@@ -29,14 +31,19 @@ export function App() {
             if (!sessionsResponse.ok) {
                 throw new Error(`Failed to load sessions: ${sessionsResponse.statusText}`);
             }
+            if (!grantsResponse.ok) {
+                throw new Error(`Failed to load connected apps: ${grantsResponse.statusText}`);
+            }
 
             const credentialsData = await credentialsResponse.json();
             const sessionsData = await sessionsResponse.json();
+            const grantsData = await grantsResponse.json();
 
             setUser({
                 username: credentialsData.username,
                 credentials: credentialsData.credentials || [],
-                sessions: sessionsData.sessions || []
+                sessions: sessionsData.sessions || [],
+                grants: grantsData.grants || []
             });
         } catch (err) {
             console.error('Failed to load user data:', err);
@@ -76,6 +83,21 @@ export function App() {
         }
     };
 
+    const refreshGrants = async () => {
+        try {
+            const response = await apiRequest('/api/v1/user/grants');
+            if (response && response.ok) {
+                const data = await response.json();
+                setUser(prev => ({
+                    ...prev,
+                    grants: data.grants || []
+                }));
+            }
+        } catch (err) {
+            console.error('Failed to refresh connected apps:', err);
+        }
+    };
+
     useEffect(() => {
         loadUserData();
     }, []);
@@ -112,6 +134,12 @@ export function App() {
                     loading={loading}
                     onRefresh={refreshSessions}
                 />
+                
+                <GrantsSection 
+                    grants={user.grants}
+                    loading={loading}
+                    onRefresh={refreshGrants}
+                />
             </div>
         </div>
     );
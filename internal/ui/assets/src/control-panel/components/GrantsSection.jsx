@@ -0,0 +1,78 @@
+import { apiRequest } from '../utils/api.js';
+
+export function GrantsSection({ grants, loading, onRefresh }) {
+    const revokeGrant = async (grant) => {
+        if (!confirm(`Are you sure you want to remove ${grant.clientName}'s access? It will need your permission again.`)) {
+            return;
+        }
+        
+        try {
+            const response = await apiRequest(`/api/v1/user/grants/${encodeURIComponent(grant.clientId)}`, {
+                method: 'DELETE'
+            });
+            
+            if (!response) return;
+            
+            if (!response.ok) {
+                throw new Error(`Failed to revoke access: ${response.statusText}`);
+            }
+            
+            // Reload grants
+            onRefresh();
+        } catch (error) {
+            alert('Failed to revoke access: ' + error.message);
+        }
+    };
+
+    return (
+        <div class="panel-section">
+            <div class="section-header">
+                <h2 class="section-title">
+                    🧩 Connected Apps
+                </h2>
+                <button 
+                    class="refresh-btn" 
+                    onClick={onRefresh} 
+                    title="Refresh"
+                    disabled={loading}
+                >
+                    🔄
+                </button>
+            </div>
+            <div class="section-content">
+                {loading ? (
+                    <div class="loading">Loading your connected apps...</div>
+                ) : grants.length === 0 ? (
+                    <div class="empty-state">
+                        <div class="empty-icon">🧩</div>
+                        <p>No apps have access to your account</p>
+                    </div>
+                ) : (
+                    <div class="item-list">
+                        {grants.map((grant) => (
+                            <div key={grant.clientId} class="item">
+                                <div class="item-info">
+                                    <div class="item-title">
+                                        {grant.clientName}
+                                    </div>
+                                    <div class="item-subtitle">
+                                        Scopes: {grant.scopes.length > 0 ? grant.scopes.join(', ') : 'sign-in only'} | 
+                                        Granted: {new Date(grant.createdAt).toLocaleString()}
+                                    </div>
+                                </div>
+                                <div class="item-actions">
+                                    <button 
+                                        class="btn btn--danger btn--sm" 
+                                        onClick={() => revokeGrant(grant)}
+                                    >
+                                        Revoke Access
+                                    </button>
+                                </div>
+                            </div>
+                        ))}
+                    </div>
+                )}
+            </div>
+        </div>
+    );
+}
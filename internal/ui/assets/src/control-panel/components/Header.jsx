@@ -8,8 +8,7 @@ export function Header({ username }) {
             } catch (error) {
                 console.error('Logout error:', error);
             }
-            // Clear the session cookie and redirect to landing page
-            document.cookie = 'session_id=; path=/; expires=Thu, 01 Jan 1970 00:00:00 GMT';
+            // The server cleared the session cookie; back to the landing page
             window.location.href = '/';
         }
     };
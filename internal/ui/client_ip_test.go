@@ -0,0 +1,59 @@
+package ui
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trustedProxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", " 192.0.2.1", "2001:db8::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oh := &OAuthUIHandlers{trustedProxies: trustedProxies}
+
+	tests := []struct {
+		name          string
+		remoteAddr    string
+		forwardedFor  []string
+		wantClientIP  string
+		noTrustedList bool
+	}{
+		{name: "direct", remoteAddr: "203.0.113.7:5000", wantClientIP: "203.0.113.7"},
+		{name: "untrusted peer's header is ignored", remoteAddr: "203.0.113.7:5000", forwardedFor: []string{"198.51.100.1"}, wantClientIP: "203.0.113.7"},
+		{name: "trusted proxy", remoteAddr: "10.1.2.3:5000", forwardedFor: []string{"198.51.100.1"}, wantClientIP: "198.51.100.1"},
+		{name: "spoofed entries before the proxy's", remoteAddr: "10.1.2.3:5000", forwardedFor: []string{"1.1.1.1, 2.2.2.2, 198.51.100.1"}, wantClientIP: "198.51.100.1"},
+		{name: "chain of trusted proxies", remoteAddr: "10.1.2.3:5000", forwardedFor: []string{"198.51.100.1, 192.0.2.1", "10.9.9.9"}, wantClientIP: "198.51.100.1"},
+		{name: "every hop trusted", remoteAddr: "10.1.2.3:5000", forwardedFor: []string{"10.4.4.4"}, wantClientIP: "10.4.4.4"},
+		{name: "trusted proxy without header", remoteAddr: "10.1.2.3:5000", wantClientIP: "10.1.2.3"},
+		{name: "IPv6 proxy", remoteAddr: "[2001:db8::1]:5000", forwardedFor: []string{"2001:db9::5"}, wantClientIP: "2001:db9::5"},
+		{name: "IPv4-mapped proxy address", remoteAddr: "[::ffff:10.1.2.3]:5000", forwardedFor: []string{"198.51.100.1"}, wantClientIP: "198.51.100.1"},
+		{name: "no trusted proxies", remoteAddr: "10.1.2.3:5000", forwardedFor: []string{"198.51.100.1"}, wantClientIP: "10.1.2.3", noTrustedList: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/device", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwardedFor {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+
+			handlers := oh
+			if tt.noTrustedList {
+				handlers = &OAuthUIHandlers{}
+			}
+			if got := handlers.clientIP(r); got != tt.wantClientIP {
+				t.Errorf("clientIP() = %q, want %q", got, tt.wantClientIP)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	for _, proxy := range []string{"10.0.0.0/33", "not-an-address", "10.0.0.1:80"} {
+		if _, err := ParseTrustedProxies([]string{proxy}); err == nil {
+			t.Errorf("ParseTrustedProxies(%q) = nil error, want error", proxy)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package ui
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/andyleap/passkey/internal/models"
+	"github.com/andyleap/passkey/internal/oauth"
+)
+
+// Stages of the device page
+const (
+	deviceStageEnterCode = "enter_code"
+	deviceStageConfirm   = "confirm"
+	deviceStageDone      = "done"
+)
+
+// devicePageData is the data of the device.html template
+type devicePageData struct {
+	Stage      string
+	UserCode   string
+	ClientName string
+	Username   string
+	Scopes     []consentScope
+	Approved   bool
+	Error      string
+}
+
+// DeviceHandler is where users enter the code shown on a device, sign in and
+// approve the device's access (RFC 8628)
+// GET /device?user_code=...
+func (oh *OAuthUIHandlers) DeviceHandler(w http.ResponseWriter, r *http.Request) {
+	userCode := r.URL.Query().Get("user_code")
+	if userCode == "" {
+		oh.renderDevicePage(w, devicePageData{Stage: deviceStageEnterCode})
+		return
+	}
+
+	session, _ := oh.sessionFromCookie(r)
+	auth, err := oh.oauthService.EnterUserCode(r.Context(), userCode, userCodeAttemptKeys(oh.clientIP(r), session))
+	if err != nil {
+		oh.renderDevicePage(w, devicePageData{
+			Stage:    deviceStageEnterCode,
+			UserCode: userCode,
+			Error:    userCodeErrorMessage(err, "Check the code shown on your device and try again."),
+		})
+		return
+	}
+
+	client, exists := oh.oauthService.GetClient(r.Context(), auth.ClientID)
+	if !exists {
+		oh.renderErrorPage(w, "Invalid Request", "Error: invalid client_id")
+		return
+	}
+
+	userCode = oauth.FormatUserCode(auth.UserCode)
+
+	if session == nil {
+		oh.renderLoginPage(w, client, map[string]string{
+			"client_id":    client.ID,
+			"continue_url": "/device?user_code=" + url.QueryEscape(userCode),
+		})
+		return
+	}
+
+	var scopes []consentScope
+	for _, scope := range strings.Fields(auth.Scope) {
+		scopes = append(scopes, consentScope{Name: scope, Description: oauth.ScopeDescription(scope)})
+	}
+
+	oh.renderDevicePage(w, devicePageData{
+		Stage:      deviceStageConfirm,
+		UserCode:   userCode,
+		ClientName: client.Name,
+		Username:   session.Username,
+		Scopes:     scopes,
+	})
+}
+
+// DeviceDecisionHandler records the user's decision for a device
+// POST /device
+func (oh *OAuthUIHandlers) DeviceDecisionHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := oh.sessionFromCookie(r)
+	if err != nil {
+		oh.renderErrorPage(w, "Sign In Required", "Please sign in with your passkey to continue.")
+		return
+	}
+
+	userCode := r.PostFormValue("user_code")
+	auth, err := oh.oauthService.EnterUserCode(r.Context(), userCode, userCodeAttemptKeys(oh.clientIP(r), session))
+	if err != nil {
+		oh.renderDevicePage(w, devicePageData{
+			Stage: deviceStageEnterCode,
+			Error: userCodeErrorMessage(err, "Start again on your device."),
+		})
+		return
+	}
+
+	client, exists := oh.oauthService.GetClient(r.Context(), auth.ClientID)
+	if !exists {
+		oh.renderErrorPage(w, "Invalid Request", "Error: invalid client_id")
+		return
+	}
+
+	approved := r.PostFormValue("decision") == "approve"
+	if approved {
+		err = oh.oauthService.ApproveDeviceAuthorization(r.Context(), userCode, session)
+	} else {
+		err = oh.oauthService.DenyDeviceAuthorization(r.Context(), userCode)
+	}
+	if err != nil {
+		slog.Error("Failed to record device authorization decision", "error", err, "username", session.Username)
+		oh.renderErrorPage(w, "Request Failed", "Your decision could not be saved. Start again on your device.")
+		return
+	}
+
+	if approved {
+		// Remember the approval so the app shows up under Connected Apps,
+		// where the user can revoke it
+		if err := oh.oauthService.GrantConsent(r.Context(), session.Username, auth.ClientID, auth.Scope); err != nil {
+			slog.Error("Failed to save consent grant", "error", err, "username", session.Username)
+		}
+	}
+
+	oh.renderDevicePage(w, devicePageData{
+		Stage:      deviceStageDone,
+		ClientName: client.Name,
+		Approved:   approved,
+	})
+}
+
+// userCodeAttemptKeys identifies who is entering a user code, so that wrong
+// codes are limited per client address and, once signed in, per session
+func userCodeAttemptKeys(clientIP string, session *models.Session) []string {
+	keys := []string{"addr:" + clientIP}
+	if session != nil {
+		keys = append(keys, "session:"+session.ID)
+	}
+	return keys
+}
+
+// userCodeErrorMessage explains why a user code was refused
+func userCodeErrorMessage(err error, retry string) string {
+	if errors.Is(err, oauth.ErrTooManyUserCodeAttempts) {
+		return "Too many incorrect codes were entered. Wait a few minutes and try again."
+	}
+	if !errors.Is(err, oauth.ErrInvalidUserCode) {
+		slog.Error("Failed to look up user code", "error", err)
+	}
+	return "That code is invalid or has expired. " + retry
+}
+
+func (oh *OAuthUIHandlers) renderDevicePage(w http.ResponseWriter, data devicePageData) {
+	w.Header().Set("Content-Type", "text/html")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	if err := oh.templates.ExecuteTemplate(w, "device.html", data); err != nil {
+		slog.Error("Failed to render device template", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,166 @@
+package ui
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/andyleap/passkey/internal/auth"
+	"github.com/andyleap/passkey/internal/models"
+	"github.com/andyleap/passkey/internal/oauth"
+)
+
+// Stages of the logout page
+const (
+	logoutStageConfirm   = "confirm"
+	logoutStageDone      = "done"
+	logoutStageNoSession = "no_session"
+)
+
+// logoutPageData is the data of the logout.html template
+type logoutPageData struct {
+	Stage      string
+	ClientName string
+	Username   string
+	Params     oauth.LogoutParams
+	// CSRFToken is posted back by the confirmation form
+	CSRFToken string
+	// ReturnURL links back to the client when no session was ended
+	ReturnURL string
+}
+
+// EndSessionHandler signs the user out at a client's request (OpenID Connect
+// RP-Initiated Logout). The user is asked to confirm unless the request
+// carries an ID token for the signed-in user.
+// GET/POST /oauth/logout?id_token_hint=...&post_logout_redirect_uri=...&state=...
+func (oh *OAuthUIHandlers) EndSessionHandler(w http.ResponseWriter, r *http.Request) {
+	params, logoutRequest, ok := oh.parseLogoutRequest(w, r)
+	if !ok {
+		return
+	}
+
+	session, _ := oh.sessionFromCookie(r)
+	if session == nil {
+		oh.renderNoSessionPage(w, logoutRequest)
+		return
+	}
+
+	if logoutRequest.Subject == "" || logoutRequest.Subject != oauth.Subject(session.UserID) {
+		oh.renderConfirmLogoutPage(w, session, params, logoutRequest)
+		return
+	}
+
+	oh.finishLogout(w, r, session, logoutRequest)
+}
+
+// EndSessionConfirmHandler signs the user out once they confirmed. The form
+// carries a token derived from the session, so a post from another site is
+// shown the confirmation page again instead of signing anybody out.
+// POST /oauth/logout/confirm
+func (oh *OAuthUIHandlers) EndSessionConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	params, logoutRequest, ok := oh.parseLogoutRequest(w, r)
+	if !ok {
+		return
+	}
+
+	session, _ := oh.sessionFromCookie(r)
+	if session == nil {
+		oh.renderNoSessionPage(w, logoutRequest)
+		return
+	}
+
+	if !oauth.VerifyLogoutConfirmationToken(session.ID, r.PostFormValue("csrf_token")) {
+		slog.Warn("Logout confirmation with an invalid CSRF token", "username", session.Username)
+		oh.renderConfirmLogoutPage(w, session, params, logoutRequest)
+		return
+	}
+
+	oh.finishLogout(w, r, session, logoutRequest)
+}
+
+// parseLogoutRequest validates the end session parameters, rendering an error
+// page if they are invalid
+func (oh *OAuthUIHandlers) parseLogoutRequest(w http.ResponseWriter, r *http.Request) (*oauth.LogoutParams, *oauth.LogoutRequest, bool) {
+	if err := r.ParseForm(); err != nil {
+		oh.renderErrorPage(w, "Invalid Request", "Malformed logout request")
+		return nil, nil, false
+	}
+
+	params := &oauth.LogoutParams{
+		IDTokenHint:           r.Form.Get("id_token_hint"),
+		ClientID:              r.Form.Get("client_id"),
+		PostLogoutRedirectURI: r.Form.Get("post_logout_redirect_uri"),
+		State:                 r.Form.Get("state"),
+	}
+
+	logoutRequest, err := oh.oauthService.ValidateLogoutRequest(r.Context(), params)
+	if errors.Is(err, oauth.ErrInvalidLogoutRequest) {
+		// Never redirect to a URI that failed validation
+		oh.renderErrorPage(w, "Invalid Logout Request", err.Error())
+		return nil, nil, false
+	}
+	if err != nil {
+		slog.Error("Failed to validate logout request", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	return params, logoutRequest, true
+}
+
+// finishLogout ends the session, clears the session cookie and sends the user
+// back to the client or shows that they were signed out
+func (oh *OAuthUIHandlers) finishLogout(w http.ResponseWriter, r *http.Request, session *models.Session, logoutRequest *oauth.LogoutRequest) {
+	if err := oh.oauthService.EndSession(r.Context(), session); err != nil {
+		slog.Error("Failed to end session", "error", err, "username", session.Username)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	slog.Info("User signed out", "username", session.Username, "client_id", logoutRequest.ClientID)
+
+	auth.ClearSessionCookie(w)
+
+	if redirectURL := oh.oauthService.LogoutRedirectURL(logoutRequest); redirectURL != "" {
+		status := http.StatusFound
+		if r.Method == http.MethodPost {
+			status = http.StatusSeeOther
+		}
+		http.Redirect(w, r, redirectURL, status)
+		return
+	}
+
+	oh.renderLogoutPage(w, logoutPageData{
+		Stage:      logoutStageDone,
+		ClientName: logoutRequest.ClientName,
+	})
+}
+
+func (oh *OAuthUIHandlers) renderConfirmLogoutPage(w http.ResponseWriter, session *models.Session, params *oauth.LogoutParams, logoutRequest *oauth.LogoutRequest) {
+	oh.renderLogoutPage(w, logoutPageData{
+		Stage:      logoutStageConfirm,
+		ClientName: logoutRequest.ClientName,
+		Username:   session.Username,
+		Params:     *params,
+		CSRFToken:  oauth.LogoutConfirmationToken(session.ID),
+	})
+}
+
+// renderNoSessionPage tells the user there was no session to end, rather
+// than sending them back to the client as if they had been signed out
+func (oh *OAuthUIHandlers) renderNoSessionPage(w http.ResponseWriter, logoutRequest *oauth.LogoutRequest) {
+	oh.renderLogoutPage(w, logoutPageData{
+		Stage:      logoutStageNoSession,
+		ClientName: logoutRequest.ClientName,
+		ReturnURL:  oh.oauthService.LogoutRedirectURL(logoutRequest),
+	})
+}
+
+func (oh *OAuthUIHandlers) renderLogoutPage(w http.ResponseWriter, data logoutPageData) {
+	w.Header().Set("Content-Type", "text/html")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	if err := oh.templates.ExecuteTemplate(w, "logout.html", data); err != nil {
+		slog.Error("Failed to render logout template", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
@@ -3,14 +3,21 @@ package ui
 import (
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"log/slog"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/andyleap/passkey/internal/auth"
 	"github.com/andyleap/passkey/internal/models"
 	"github.com/andyleap/passkey/internal/oauth"
+	"github.com/andyleap/passkey/internal/storage"
 )
 
 //go:embed templates/*.html
@@ -20,11 +27,15 @@ var templatesFS embed.FS
 var assetsFS embed.FS
 
 type OAuthUIHandlers struct {
-	oauthService *oauth.OAuthService
-	templates    *template.Template
+	oauthService   *oauth.OAuthService
+	sessionStorage storage.SessionStorage
+	templates      *template.Template
+	// trustedProxies are the reverse proxies whose X-Forwarded-For header
+	// gives the client's address
+	trustedProxies []netip.Prefix
 }
 
-func NewOAuthUIHandlers(oauthService *oauth.OAuthService) (*OAuthUIHandlers, error) {
+func NewOAuthUIHandlers(oauthService *oauth.OAuthService, sessionStorage storage.SessionStorage, trustedProxies []netip.Prefix) (*OAuthUIHandlers, error) {
 	// Parse embedded templates
 	templates, err := template.ParseFS(templatesFS, "templates/*.html")
 	if err != nil {
@@ -32,14 +43,22 @@ func NewOAuthUIHandlers(oauthService *oauth.OAuthService) (*OAuthUIHandlers, err
 	}
 
 	return &OAuthUIHandlers{
-		oauthService: oauthService,
-		templates:    templates,
+		oauthService:   oauthService,
+		sessionStorage: sessionStorage,
+		templates:      templates,
+		trustedProxies: trustedProxies,
 	}, nil
 }
 
 // AuthorizeHandler handles OAuth authorization requests
 // GET /authorize?client_id=myapp&redirect_uri=https://myapp.com/callback&state=xyz123
+// GET /authorize?client_id=myapp&request_uri=urn:ietf:params:oauth:request_uri:...
 func (oh *OAuthUIHandlers) AuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	if requestURI := r.URL.Query().Get("request_uri"); requestURI != "" {
+		oh.authorizePushed(w, r, r.URL.Query().Get("client_id"), requestURI)
+		return
+	}
+
 	clientID := r.URL.Query().Get("client_id")
 	redirectURI := r.URL.Query().Get("redirect_uri")
 	state := r.URL.Query().Get("state")
@@ -54,18 +73,109 @@ func (oh *OAuthUIHandlers) AuthorizeHandler(w http.ResponseWriter, r *http.Reque
 	}
 
 	// Validate the authorization request
-	client, err := oh.oauthService.ValidateAuthorizationRequest(clientID, redirectURI)
+	client, err := oh.oauthService.ValidateAuthorizationRequest(r.Context(), clientID, redirectURI)
 	if err != nil {
 		// For invalid client, we can't redirect back, so show error page
 		oh.renderErrorPage(w, "Invalid Request", fmt.Sprintf("Error: %s", err.Error()))
 		return
 	}
 
-	// Create authorization request
-	authRequest, err := oh.oauthService.CreateAuthorizationRequest(clientID, redirectURI, state)
+	// Errors are returned in the requested response mode; an unsupported
+	// response_mode is itself reported by CreateAuthorizationRequest
+	responseMode, err := oauth.ResolveResponseMode(client, r.URL.Query().Get("response_mode"))
+	if err != nil {
+		responseMode = models.ResponseModeQuery
+	}
+
+	var maxAge *int
+	if value := r.URL.Query().Get("max_age"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil {
+			oh.sendAuthorizationResponse(w, r, clientID, redirectURI, responseMode,
+				oauth.ErrorResponseParams("invalid_request", "max_age must be a number of seconds", state))
+			return
+		}
+		maxAge = &seconds
+	}
+
+	oh.startAuthorization(w, r, client, responseMode, oauth.AuthorizationParams{
+		ClientID:            clientID,
+		RedirectURI:         redirectURI,
+		State:               state,
+		CodeChallenge:       r.URL.Query().Get("code_challenge"),
+		CodeChallengeMethod: r.URL.Query().Get("code_challenge_method"),
+		Scope:               r.URL.Query().Get("scope"),
+		Nonce:               r.URL.Query().Get("nonce"),
+		Prompt:              r.URL.Query().Get("prompt"),
+		MaxAge:              maxAge,
+		LoginHint:           r.URL.Query().Get("login_hint"),
+		ResponseMode:        r.URL.Query().Get("response_mode"),
+	})
+}
+
+// authorizePushed handles an authorization request made by reference to a
+// pushed authorization request (RFC 9126 section 4). Any other query
+// parameters are ignored in favour of the pushed ones.
+func (oh *OAuthUIHandlers) authorizePushed(w http.ResponseWriter, r *http.Request, clientID, requestURI string) {
+	if clientID == "" {
+		oh.renderErrorPage(w, "Invalid Request", "client_id is required")
+		return
+	}
+
+	params, err := oh.oauthService.ResolvePushedAuthorizationRequest(r.Context(), clientID, requestURI)
 	if err != nil {
-		redirectURL := oh.oauthService.BuildErrorRedirectURL(redirectURI, "server_error", "Failed to process request", state)
-		http.Redirect(w, r, redirectURL, http.StatusFound)
+		// Without a valid pushed request there's no verified redirect URI
+		if !errors.Is(err, oauth.ErrInvalidRequestURI) {
+			slog.Error("Failed to resolve pushed authorization request", "error", err)
+		}
+		oh.renderErrorPage(w, "Request Expired", "This authorization request is invalid or has expired. Please return to the application and try again.")
+		return
+	}
+
+	client, err := oh.oauthService.ValidateAuthorizationRequest(r.Context(), params.ClientID, params.RedirectURI)
+	if err != nil {
+		oh.renderErrorPage(w, "Invalid Request", fmt.Sprintf("Error: %s", err.Error()))
+		return
+	}
+
+	responseMode, err := oauth.ResolveResponseMode(client, params.ResponseMode)
+	if err != nil {
+		responseMode = models.ResponseModeQuery
+	}
+
+	oh.startAuthorization(w, r, client, responseMode, *params)
+}
+
+// startAuthorization creates the authorization request and sends the user on
+// to sign in, to consent, or straight back to the client
+func (oh *OAuthUIHandlers) startAuthorization(w http.ResponseWriter, r *http.Request, client *models.Client, responseMode string, params oauth.AuthorizationParams) {
+	authRequest, err := oh.oauthService.CreateAuthorizationRequest(r.Context(), params)
+	if err != nil {
+		var authErr *oauth.AuthorizationError
+		if errors.As(err, &authErr) {
+			oh.sendAuthorizationResponse(w, r, client.ID, params.RedirectURI, responseMode,
+				oauth.ErrorResponseParams(authErr.Code, authErr.Description, params.State))
+			return
+		}
+		slog.Error("Failed to create authorization request", "error", err)
+		oh.sendAuthorizationResponse(w, r, client.ID, params.RedirectURI, responseMode,
+			oauth.ErrorResponseParams("server_error", "Failed to process request", params.State))
+		return
+	}
+
+	// An existing session can be reused unless the request asks for a fresh sign-in
+	session, err := oh.sessionFromCookie(r)
+	if err != nil || !oauth.SessionSatisfies(authRequest, session) {
+		session = nil
+	}
+
+	if oauth.HasPrompt(authRequest, oauth.PromptNone) {
+		oh.authorizeWithoutPrompt(w, r, authRequest, session)
+		return
+	}
+
+	if session != nil {
+		http.Redirect(w, r, "/oauth/consent?request_id="+url.QueryEscape(authRequest.ID), http.StatusFound)
 		return
 	}
 
@@ -73,6 +183,187 @@ func (oh *OAuthUIHandlers) AuthorizeHandler(w http.ResponseWriter, r *http.Reque
 	oh.renderAuthorizePage(w, client, authRequest)
 }
 
+// authorizeWithoutPrompt handles prompt=none: the request succeeds only if the
+// user is already signed in and has already consented, and otherwise fails
+// with login_required or consent_required instead of showing any page. The
+// session comes from the cookie, which the browser sends on the top-level
+// redirect from a client on another site.
+func (oh *OAuthUIHandlers) authorizeWithoutPrompt(w http.ResponseWriter, r *http.Request, authRequest *models.AuthorizationRequest, session *models.Session) {
+	errorCode := ""
+	if session == nil {
+		errorCode = "login_required"
+	} else {
+		consented, err := oh.oauthService.HasConsent(r.Context(), session.Username, authRequest.ClientID, authRequest.Scope)
+		if err != nil {
+			slog.Error("Failed to check consent", "error", err, "username", session.Username)
+		}
+		if !consented {
+			errorCode = "consent_required"
+		}
+	}
+
+	authRequest, err := oh.oauthService.ConsumeAuthorizationRequest(r.Context(), authRequest.ID)
+	if err != nil {
+		slog.Error("Invalid authorization request", "error", err)
+		oh.renderErrorPage(w, "Request Expired", "This authorization request is invalid or has expired. Please return to the application and try again.")
+		return
+	}
+
+	if errorCode != "" {
+		oh.redirectWithError(w, r, authRequest, errorCode, "")
+		return
+	}
+
+	oh.redirectWithCode(w, r, authRequest, session)
+}
+
+// ConsentHandler shows the signed-in user what the client is asking for
+// GET /oauth/consent?request_id=...
+func (oh *OAuthUIHandlers) ConsentHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := oh.sessionFromCookie(r)
+	if err != nil {
+		oh.renderErrorPage(w, "Sign In Required", "Please sign in with your passkey to continue.")
+		return
+	}
+
+	authRequest, err := oh.oauthService.GetAuthorizationRequest(r.Context(), r.URL.Query().Get("request_id"))
+	if err != nil {
+		oh.renderErrorPage(w, "Request Expired", "This authorization request is invalid or has expired. Please return to the application and try again.")
+		return
+	}
+
+	if !oauth.SessionSatisfies(authRequest, session) {
+		oh.renderErrorPage(w, "Sign In Required", "This application asked you to sign in again. Please return to the application and try again.")
+		return
+	}
+
+	client, exists := oh.oauthService.GetClient(r.Context(), authRequest.ClientID)
+	if !exists {
+		oh.renderErrorPage(w, "Invalid Request", "Error: invalid client_id")
+		return
+	}
+
+	// Don't ask again for access the user has already granted, unless the
+	// client asked for the consent page with prompt=consent
+	consented := false
+	if !oauth.HasPrompt(authRequest, oauth.PromptConsent) {
+		consented, err = oh.oauthService.HasConsent(r.Context(), session.Username, client.ID, authRequest.Scope)
+		if err != nil {
+			slog.Error("Failed to check consent", "error", err, "username", session.Username)
+		}
+	}
+	if consented {
+		authRequest, err := oh.oauthService.ConsumeAuthorizationRequest(r.Context(), authRequest.ID)
+		if err != nil {
+			slog.Error("Invalid authorization request", "error", err)
+			oh.renderErrorPage(w, "Request Expired", "This authorization request is invalid or has expired. Please return to the application and try again.")
+			return
+		}
+		oh.redirectWithCode(w, r, authRequest, session)
+		return
+	}
+
+	oh.renderConsentPage(w, client, authRequest, session)
+}
+
+// ConsentDecisionHandler issues an authorization code when the user approves
+// and reports access_denied to the client otherwise
+// POST /oauth/consent
+func (oh *OAuthUIHandlers) ConsentDecisionHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := oh.sessionFromCookie(r)
+	if err != nil {
+		oh.renderErrorPage(w, "Sign In Required", "Please sign in with your passkey to continue.")
+		return
+	}
+
+	requestID := r.PostFormValue("request_id")
+	if !oauth.VerifyConsentToken(session.ID, requestID, r.PostFormValue("csrf_token")) {
+		slog.Warn("Consent decision with an invalid CSRF token", "username", session.Username)
+		oh.renderErrorPage(w, "Invalid Request", "Your decision could not be verified. Please return to the application and try again.")
+		return
+	}
+
+	authRequest, err := oh.oauthService.ConsumeAuthorizationRequest(r.Context(), requestID)
+	if err != nil {
+		slog.Error("Invalid authorization request", "error", err)
+		oh.renderErrorPage(w, "Request Expired", "This authorization request is invalid or has expired. Please return to the application and try again.")
+		return
+	}
+
+	if r.PostFormValue("decision") != "approve" {
+		oh.redirectWithError(w, r, authRequest, "access_denied", "The user denied the request")
+		return
+	}
+
+	// Remember the decision so the user isn't asked again
+	if err := oh.oauthService.GrantConsent(r.Context(), session.Username, authRequest.ClientID, authRequest.Scope); err != nil {
+		slog.Error("Failed to save consent grant", "error", err, "username", session.Username)
+	}
+
+	oh.redirectWithCode(w, r, authRequest, session)
+}
+
+// redirectWithCode sends the user back to the client with an authorization code
+func (oh *OAuthUIHandlers) redirectWithCode(w http.ResponseWriter, r *http.Request, authRequest *models.AuthorizationRequest, session *models.Session) {
+	authCode, err := oh.oauthService.CreateAuthorizationCode(r.Context(), authRequest, session)
+	if err != nil {
+		slog.Error("Failed to create authorization code", "error", err)
+		oh.redirectWithError(w, r, authRequest, "server_error", "Failed to process request")
+		return
+	}
+
+	oh.sendAuthorizationResponse(w, r, authRequest.ClientID, authRequest.RedirectURI, authRequest.ResponseMode,
+		oauth.CodeResponseParams(authCode.Code, authRequest.State))
+}
+
+// redirectWithError sends the user back to the client with an error
+func (oh *OAuthUIHandlers) redirectWithError(w http.ResponseWriter, r *http.Request, authRequest *models.AuthorizationRequest, errorCode, errorDescription string) {
+	oh.sendAuthorizationResponse(w, r, authRequest.ClientID, authRequest.RedirectURI, authRequest.ResponseMode,
+		oauth.ErrorResponseParams(errorCode, errorDescription, authRequest.State))
+}
+
+// sendAuthorizationResponse returns the authorization response to the client
+// in the given response mode: a redirect with the parameters in the query or
+// fragment, or for form_post a page that posts them to the redirect URI so
+// they never appear in a URL
+func (oh *OAuthUIHandlers) sendAuthorizationResponse(w http.ResponseWriter, r *http.Request, clientID, redirectURI, responseMode string, params url.Values) {
+	if responseMode == models.ResponseModeFormPost {
+		oh.renderFormPostPage(w, r, clientID, redirectURI, params)
+		return
+	}
+
+	status := http.StatusFound
+	if r.Method == http.MethodPost {
+		status = http.StatusSeeOther
+	}
+	http.Redirect(w, r, oh.oauthService.BuildResponseURL(redirectURI, responseMode, params), status)
+}
+
+// sessionFromCookie returns the session set by the passkey sign-in. The cookie
+// is SameSite=Lax: cross-site navigations carry it, cross-site form posts
+// don't.
+func (oh *OAuthUIHandlers) sessionFromCookie(r *http.Request) (*models.Session, error) {
+	cookie, err := r.Cookie(auth.SessionCookieName)
+	if err != nil {
+		return nil, fmt.Errorf("no session found")
+	}
+
+	session, err := oh.sessionStorage.GetSession(r.Context(), cookie.Value)
+	if err != nil || session == nil {
+		return nil, fmt.Errorf("invalid session")
+	}
+	if session.ExpiresAt.Before(time.Now()) {
+		return nil, fmt.Errorf("session expired")
+	}
+	// Page loads can't carry a DPoP proof, so a session bound to a DPoP key
+	// is never accepted from a cookie
+	if session.DPoPJKT != "" {
+		return nil, fmt.Errorf("session is bound to a DPoP key")
+	}
+
+	return session, nil
+}
+
 // AssetsHandler serves embedded static assets
 func (oh *OAuthUIHandlers) AssetsHandler(w http.ResponseWriter, r *http.Request) {
 	// Extract filename from URL path (/oauth/filename.ext)
@@ -113,19 +404,24 @@ func (oh *OAuthUIHandlers) AssetsHandler(w http.ResponseWriter, r *http.Request)
 }
 
 func (oh *OAuthUIHandlers) renderAuthorizePage(w http.ResponseWriter, client *models.Client, authRequest *models.AuthorizationRequest) {
-	// Prepare data for the template
-	authData, _ := json.Marshal(map[string]string{
-		"client_id":    authRequest.ClientID,
-		"redirect_uri": authRequest.RedirectURI,
-		"state":        authRequest.State,
+	oh.renderLoginPage(w, client, map[string]string{
+		"request_id": authRequest.ID,
+		"client_id":  authRequest.ClientID,
+		"login_hint": authRequest.LoginHint,
 	})
+}
+
+// renderLoginPage renders the passkey sign-in page; authData is passed to
+// auth.js, which continues to continue_url or the consent page afterwards
+func (oh *OAuthUIHandlers) renderLoginPage(w http.ResponseWriter, client *models.Client, authData map[string]string) {
+	authDataJSON, _ := json.Marshal(authData)
 
 	data := struct {
 		ClientName   string
 		AuthDataJSON template.JS
 	}{
 		ClientName:   client.Name,
-		AuthDataJSON: template.JS(authData),
+		AuthDataJSON: template.JS(authDataJSON),
 	}
 
 	w.Header().Set("Content-Type", "text/html")
@@ -135,6 +431,74 @@ func (oh *OAuthUIHandlers) renderAuthorizePage(w http.ResponseWriter, client *mo
 	}
 }
 
+// consentScope is a requested scope as shown on the consent page
+type consentScope struct {
+	Name        string
+	Description string
+}
+
+func (oh *OAuthUIHandlers) renderConsentPage(w http.ResponseWriter, client *models.Client, authRequest *models.AuthorizationRequest, session *models.Session) {
+	var scopes []consentScope
+	for _, scope := range strings.Fields(authRequest.Scope) {
+		scopes = append(scopes, consentScope{Name: scope, Description: oauth.ScopeDescription(scope)})
+	}
+
+	data := struct {
+		ClientName string
+		Username   string
+		RequestID  string
+		CSRFToken  string
+		Scopes     []consentScope
+	}{
+		ClientName: client.Name,
+		Username:   session.Username,
+		RequestID:  authRequest.ID,
+		CSRFToken:  oauth.ConsentToken(session.ID, authRequest.ID),
+		Scopes:     scopes,
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	w.Header().Set("Cache-Control", "no-store")
+	// The consent page must not be framed by the client (clickjacking)
+	w.Header().Set("X-Frame-Options", "DENY")
+	if err := oh.templates.ExecuteTemplate(w, "consent.html", data); err != nil {
+		slog.Error("Failed to render consent template", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func (oh *OAuthUIHandlers) renderFormPostPage(w http.ResponseWriter, r *http.Request, clientID, redirectURI string, params url.Values) {
+	clientName := clientID
+	if client, exists := oh.oauthService.GetClient(r.Context(), clientID); exists {
+		clientName = client.Name
+	}
+
+	fields := make(map[string]string, len(params))
+	for name := range params {
+		fields[name] = params.Get(name)
+	}
+
+	data := struct {
+		ClientName  string
+		RedirectURI template.URL
+		Params      map[string]string
+	}{
+		ClientName: clientName,
+		// The redirect URI was matched against the client's registered URIs,
+		// which may use a custom scheme html/template would otherwise reject
+		RedirectURI: template.URL(redirectURI),
+		Params:      fields,
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	if err := oh.templates.ExecuteTemplate(w, "form_post.html", data); err != nil {
+		slog.Error("Failed to render form_post template", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
 func (oh *OAuthUIHandlers) renderErrorPage(w http.ResponseWriter, title, message string) {
 	data := struct {
 		Title   string